@@ -0,0 +1,24 @@
+package main
+
+// Allocator supplies the tree's nodes, letting an embedding program pool or
+// arena-allocate them. Nodes dropped by merges, root collapses and Clear are
+// handed back through FreeNode, except from trees sharing nodes with a
+// WithInsert version, whose nodes may still be in use elsewhere.
+type Allocator[K comparable, V any] interface {
+	AllocNode() *BPlusTreeNode[K, V]
+	FreeNode(n *BPlusTreeNode[K, V])
+}
+
+// heapAllocator is the default Allocator: plain new, with freeing left to the GC.
+type heapAllocator[K comparable, V any] struct{}
+
+func (heapAllocator[K, V]) AllocNode() *BPlusTreeNode[K, V] { return new(BPlusTreeNode[K, V]) }
+func (heapAllocator[K, V]) FreeNode(*BPlusTreeNode[K, V])   {}
+
+// freeAll returns every node under n to alloc.
+func freeAll[K comparable, V any](alloc Allocator[K, V], n *BPlusTreeNode[K, V]) {
+	for _, child := range n.children {
+		freeAll(alloc, child)
+	}
+	alloc.FreeNode(n)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/maphash"
+	"math"
+	"time"
+)
+
+// bloomFilter answers "definitely absent" for keys never added to it. Bits
+// are only ever set, so a deleted key keeps looking possibly present until
+// the filter is rebuilt.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64 // Number of bits
+	k      int    // Hash functions per key
+	seed   maphash.Seed
+	expect int
+	fpRate float64
+}
+
+func newBloomFilter(expectedN int, fpRate float64) *bloomFilter {
+	// The standard sizing for n keys at false positive rate p
+	m := math.Ceil(-float64(expectedN) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := max(int(math.Round(m/float64(expectedN)*math.Ln2)), 1)
+	words := (uint64(m) + 63) / 64
+	return &bloomFilter{
+		bits:   make([]uint64, words),
+		m:      words * 64,
+		k:      k,
+		seed:   maphash.MakeSeed(),
+		expect: expectedN,
+		fpRate: fpRate,
+	}
+}
+
+func (f *bloomFilter) clone() *bloomFilter {
+	c := *f
+	c.bits = append([]uint64(nil), f.bits...)
+	return &c
+}
+
+func (f *bloomFilter) reset() {
+	clear(f.bits)
+}
+
+// Each key's k bit positions come from one 64-bit hash split in two, the
+// usual double hashing.
+func (f *bloomFilter) add(h uint64) {
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) mayContain(h uint64) bool {
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	for i := range f.k {
+		bit := (h1 + uint64(i)*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHash hashes a key consistently with the ready-made comparators: equal
+// under IntEqual, StringEqual, Float64Equal or TimeEqual means equal hashes.
+// Other types are hashed by their %v form, which matches == for most
+// comparable types.
+func (f *bloomFilter) hash(key any) uint64 {
+	var buf [8]byte
+	switch k := key.(type) {
+	case string:
+		return maphash.String(f.seed, k)
+	case int:
+		binary.LittleEndian.PutUint64(buf[:], uint64(k))
+	case int64:
+		binary.LittleEndian.PutUint64(buf[:], uint64(k))
+	case uint64:
+		binary.LittleEndian.PutUint64(buf[:], k)
+	case float64:
+		if k == 0 {
+			k = 0 // -0 and +0 are the same key
+		}
+		if math.IsNaN(k) {
+			k = math.NaN() // As is every NaN
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(k))
+	case time.Time:
+		binary.LittleEndian.PutUint64(buf[:], uint64(k.UnixNano()))
+	default:
+		return maphash.String(f.seed, fmt.Sprintf("%v", key))
+	}
+	return maphash.Bytes(f.seed, buf[:])
+}
+
+// EnableBloomFilter keeps a Bloom filter of the tree's keys, sized for
+// expectedN keys at false positive rate fpRate, so that Search, and Get and
+// Exists through it, can answer for most absent keys without descending the
+// tree. Every key already present is added, and each insert adds its key.
+//
+// A Bloom filter can't forget a key, so deleted keys stay "possibly present"
+// and cost a descent as before. Clear, ReplaceAll, LoadSortedFile and
+// Reindex rebuild it from the keys left, as does RebuildBloomFilter, which is
+// worth calling after heavy deletion. Once well past expectedN keys the
+// false positive rate climbs; enable it again with a larger size.
+//
+// The filter hashes keys, so keys that equal treats as the same must hash
+// alike. That holds for ==, for the ready-made comparators and for keys
+// stored through WithKeyNormalizer; under WithSortKey the sort key is hashed
+// instead of the key, so it holds there too. It does not hold for a less and
+// equal that ignore part of the key, such as CollateCaseInsensitive, where
+// the filter would wrongly report keys missing.
+func (t *BPlusTree[K, V]) EnableBloomFilter(expectedN int, fpRate float64) error {
+	if expectedN <= 0 {
+		return fmt.Errorf("bloom filter: expected key count %d must be positive", expectedN)
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		return fmt.Errorf("bloom filter: false positive rate %v must be between 0 and 1", fpRate)
+	}
+	t.bloom = newBloomFilter(expectedN, fpRate)
+	t.RebuildBloomFilter()
+	return nil
+}
+
+// DisableBloomFilter drops the filter, if any.
+func (t *BPlusTree[K, V]) DisableBloomFilter() {
+	t.bloom = nil
+}
+
+// RebuildBloomFilter refills the filter from the keys now in the tree, so
+// deleted keys stop passing it. It does nothing without EnableBloomFilter.
+func (t *BPlusTree[K, V]) RebuildBloomFilter() {
+	if t.bloom == nil {
+		return
+	}
+	t.bloom.reset()
+	t.ascend(func(k K, _ V) bool {
+		t.bloom.add(t.bloomHash(k))
+		return true
+	})
+}
+
+// bloomAdd records a new key in the filter, if any.
+func (t *BPlusTree[K, V]) bloomAdd(key K) {
+	if t.bloom != nil {
+		t.bloom.add(t.bloomHash(key))
+	}
+}
+
+// bloomExcludes reports whether the filter rules key out.
+func (t *BPlusTree[K, V]) bloomExcludes(key K) bool {
+	return t.bloom != nil && !t.bloom.mayContain(t.bloomHash(key))
+}
+
+// bloomHash hashes key for the filter. Under WithSortKey keys with equal sort
+// keys are the same key, so the sort key is what gets hashed.
+func (t *BPlusTree[K, V]) bloomHash(key K) uint64 {
+	if t.sortKeys != nil {
+		return maphash.Bytes(t.bloom.seed, t.sortKeys.get(key))
+	}
+	return t.bloom.hash(key)
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+)
+
+// bulkBuilder packs pairs that arrive in ascending key order straight into
+// full leaves, then stacks internal levels on top in finish. Nothing but the
+// tree itself (and one pointer per node of the level being built) is held.
+type bulkBuilder[K comparable, V any] struct {
+	tree   *BPlusTree[K, V]
+	leaves []*BPlusTreeNode[K, V]
+	expect int // Pairs still to come if known from expecting, else 0
+}
+
+func newBulkBuilder[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool) *bulkBuilder[K, V] {
+	return &bulkBuilder[K, V]{tree: NewBPlusTree[K, V](order, less, equal)}
+}
+
+// expecting tells the builder how many pairs will be added, so leaves can be
+// allocated at their exact final size.
+func (b *bulkBuilder[K, V]) expecting(n int) {
+	maxKeys := 2 * (b.tree.order - 1)
+	b.leaves = make([]*BPlusTreeNode[K, V], 0, (n+maxKeys-1)/maxKeys)
+	b.expect = n
+}
+
+// follows returns an ErrUnsortedInput error unless key sorts strictly after
+// prev, for the paths that take sorted input from the caller.
+func follows[K any](less func(K, K) bool, prev K, key K) error {
+	if less(prev, key) {
+		return nil
+	}
+	return fmt.Errorf("key '%v' does not follow '%v': %w", key, prev, ErrUnsortedInput)
+}
+
+// addSorted is add for pairs from the caller, checking that key follows the
+// last key added rather than trusting it to.
+func (b *bulkBuilder[K, V]) addSorted(key K, value V) error {
+	if n := len(b.leaves); n > 0 {
+		last := b.leaves[n-1]
+		if err := follows(b.tree.less, last.keys[len(last.keys)-1], key); err != nil {
+			return err
+		}
+	}
+	b.add(key, value)
+	return nil
+}
+
+// add appends the next pair. Keys must be strictly increasing, which only
+// addSorted checks.
+func (b *bulkBuilder[K, V]) add(key K, value V) {
+	maxKeys := 2 * (b.tree.order - 1)
+	var leaf *BPlusTreeNode[K, V]
+	if len(b.leaves) > 0 {
+		leaf = b.leaves[len(b.leaves)-1]
+	}
+	if leaf == nil || len(leaf.keys) == maxKeys {
+		next := newBPlusTreeNode(b.tree.alloc, b.tree.order)
+		// Full leaves, or the exact remainder for the last one when known,
+		// instead of growing by repeated appends
+		size := maxKeys
+		if b.expect > 0 && b.expect < size {
+			size = b.expect
+		}
+		next.keys = reserve(next.keys, size)
+		next.values = reserve(next.values, size)
+		if leaf != nil {
+			leaf.next = next
+		}
+		leaf = next
+		b.leaves = append(b.leaves, leaf)
+	}
+	leaf.keys = append(leaf.keys, key)
+	leaf.values = append(leaf.values, value)
+	if b.expect > 0 {
+		b.expect--
+	}
+}
+
+// reserve returns s emptied, with room for at least n elements.
+func reserve[T any](s []T, n int) []T {
+	if cap(s) >= n {
+		return s[:0]
+	}
+	return make([]T, 0, n)
+}
+
+// finish builds the internal levels and returns the loaded tree.
+func (b *bulkBuilder[K, V]) finish() *BPlusTree[K, V] {
+	if len(b.leaves) == 0 {
+		b.tree.root = newBPlusTreeNode(b.tree.alloc, b.tree.order)
+		return b.tree
+	}
+	minKeys := b.tree.order - 2
+	level := b.leaves
+	// lows[i] is the smallest key under level[i], used as its separator
+	lows := make([]K, len(level))
+	for i, leaf := range level {
+		lows[i] = leaf.keys[0]
+	}
+	if n := len(level); n > 1 && len(level[n-1].keys) < minKeys {
+		b.balanceLeaves(level[n-2], level[n-1])
+		lows[n-1] = level[n-1].keys[0]
+	}
+
+	fanout := 2*(b.tree.order-1) + 1
+	for len(level) > 1 {
+		groups := (len(level) + fanout - 1) / fanout
+		parents := make([]*BPlusTreeNode[K, V], 0, groups)
+		parentLows := make([]K, 0, groups)
+		for start := 0; start < len(level); start += fanout {
+			end := start + fanout
+			if end > len(level) {
+				end = len(level)
+			}
+			parent := newBPlusTreeNode(b.tree.alloc, b.tree.order)
+			parent.isLeaf = false
+			parent.children = append(reserve(parent.children, fanout), level[start:end]...)
+			parent.keys = append(reserve(parent.keys, fanout-1), lows[start+1:end]...)
+			parents = append(parents, parent)
+			parentLows = append(parentLows, lows[start])
+		}
+		if n := len(parents); n > 1 && len(parents[n-1].keys) < minKeys {
+			b.balanceInternal(parents[n-2], parents[n-1], &parentLows[n-1])
+		}
+		level, lows = parents, parentLows
+	}
+	b.tree.root = level[0]
+	return b.tree
+}
+
+// balanceLeaves evens out the last two leaves when the final one came up short.
+func (b *bulkBuilder[K, V]) balanceLeaves(left *BPlusTreeNode[K, V], right *BPlusTreeNode[K, V]) {
+	keys := append(append([]K{}, left.keys...), right.keys...)
+	values := append(append([]V{}, left.values...), right.values...)
+	half := len(keys) / 2
+	// Cap the left halves so a later append can't spill into the right node
+	left.keys, right.keys = keys[:half:half], keys[half:]
+	left.values, right.values = values[:half:half], values[half:]
+}
+
+// balanceInternal evens out the children of the last two internal nodes of a
+// level, pulling the old separator down and pushing the new one up via low.
+func (b *bulkBuilder[K, V]) balanceInternal(left *BPlusTreeNode[K, V], right *BPlusTreeNode[K, V], low *K) {
+	children := append(append([]*BPlusTreeNode[K, V]{}, left.children...), right.children...)
+	keys := append(append(append([]K{}, left.keys...), *low), right.keys...)
+	half := len(children) / 2
+	left.children, right.children = children[:half:half], children[half:]
+	left.keys, right.keys = keys[:half-1:half-1], keys[half:]
+	*low = keys[half-1]
+}
+
+// BulkLoad builds a tree from pairs already sorted by key with no duplicates,
+// packing leaves directly instead of inserting one pair at a time. Each key
+// is checked against the one before it as it is packed, and the first that
+// doesn't strictly follow it fails the load with ErrUnsortedInput and its
+// index, rather than producing a tree whose lookups silently miss.
+func BulkLoad[K comparable, V any](pairs []Pair[K, V], order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	b := newBulkBuilder[K, V](order, less, equal)
+	b.expecting(len(pairs))
+	for i, p := range pairs {
+		if err := b.addSorted(p.Key, p.Value); err != nil {
+			return nil, fmt.Errorf("bulk load: pair %d: %w", i, err)
+		}
+	}
+	return b.finish(), nil
+}
+
+// FromMap builds a tree holding the contents of m. The keys are sorted with
+// less first so the tree can be bulk loaded rather than built by inserts.
+func FromMap[K comparable, V any](m map[K]V, order int, less func(K, K) bool, equal func(K, K) bool) *BPlusTree[K, V] {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	b := newBulkBuilder[K, V](order, less, equal)
+	b.expecting(len(keys))
+	for _, k := range keys {
+		b.add(k, m[k])
+	}
+	return b.finish()
+}
+
+// MapValues builds a new tree with the same keys and comparators as t and
+// each value replaced by f(value). Keys come out of t already sorted, so the
+// result is bulk loaded in one pass.
+func MapValues[K comparable, V any, V2 any](t *BPlusTree[K, V], f func(V) V2) *BPlusTree[K, V2] {
+	b := newBulkBuilder[K, V2](t.order, t.less, t.equal)
+	t.ascend(func(k K, v V) bool {
+		b.add(k, f(v))
+		return true
+	})
+	return b.finish()
+}
+
+// BuildFromChan builds a tree from the pairs received on ch, returning once ch
+// is closed. With sorted set the pairs must arrive in strictly increasing key
+// order and are bulk loaded; the first pair out of order fails the build with
+// ErrUnsortedInput, after the rest of ch is drained so the sender isn't left
+// blocked. Otherwise each is inserted as it arrives, later duplicates
+// overwriting earlier ones.
+func BuildFromChan[K comparable, V any](ch <-chan Pair[K, V], sorted bool, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	if !sorted {
+		t := NewBPlusTree[K, V](order, less, equal)
+		for p := range ch {
+			t.Insert(p.Key, p.Value)
+		}
+		return t, nil
+	}
+	b := newBulkBuilder[K, V](order, less, equal)
+	n := 0
+	for p := range ch {
+		if err := b.addSorted(p.Key, p.Value); err != nil {
+			for range ch {
+			}
+			return nil, fmt.Errorf("build: pair %d: %w", n, err)
+		}
+		n++
+	}
+	return b.finish(), nil
+}
+
+// Reindex re-sorts the tree under a new ordering and rebuilds it in place,
+// keeping its options and bookkeeping. Keys that become equal under the new
+// comparators collapse into one entry: resolve picks the surviving pair from
+// the two colliding ones (the first is the one earlier in the old order), and
+// with a nil resolve the first is kept. Dropped keys are reported through
+// OnDelete hooks. With a non-nil resolve, each surviving key of a collision is
+// also reported through OnUpdate with its value before and after, even when
+// resolve returned that same value: values can't be compared in general, and
+// Insert likewise fires OnUpdate for any overwrite. It returns how many
+// entries were dropped.
+func (t *BPlusTree[K, V]) Reindex(less func(K, K) bool, equal func(K, K) bool, resolve func(a, b Pair[K, V]) Pair[K, V]) int {
+	t.mustWritable("reindex")
+	var pairs []Pair[K, V]
+	t.ascend(func(k K, v V) bool {
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	sort.SliceStable(pairs, func(i, j int) bool { return less(pairs[i].Key, pairs[j].Key) })
+
+	var kept, dropped []Pair[K, V]
+	var updated []Pair[K, V] // Kept keys with their value before resolve picked one
+	for _, p := range pairs {
+		n := len(kept)
+		if n == 0 || !equal(kept[n-1].Key, p.Key) {
+			kept = append(kept, p)
+			continue
+		}
+		first := kept[n-1]
+		winner := first
+		if resolve != nil {
+			winner = resolve(first, p)
+		}
+		kept[n-1] = winner
+		// Whichever of the two keys lost is gone from the tree
+		survivor := first
+		if t.equal(winner.Key, first.Key) {
+			dropped = append(dropped, p)
+		} else {
+			dropped = append(dropped, first)
+			survivor = p
+		}
+		if resolve != nil {
+			updated = append(updated, survivor)
+		}
+	}
+
+	if t.root != nil && !t.cow {
+		freeAll(t.alloc, t.root)
+	}
+	t.less, t.equal = less, equal
+	t.sortKeys = nil // The new comparators replace any WithSortKey ordering
+	t.cow = false
+	t.modCount++
+	b := &bulkBuilder[K, V]{tree: t}
+	b.expecting(len(kept))
+	for _, p := range kept {
+		b.add(p.Key, p.Value)
+	}
+	b.finish()
+	t.RebuildBloomFilter()
+
+	for _, p := range dropped {
+		t.forget(p.Key)
+		if t.versions != nil {
+			delete(t.versions, p.Key)
+		}
+		if t.meta != nil {
+			delete(t.meta, p.Key)
+		}
+		if t.access != nil {
+			delete(t.access, p.Key)
+		}
+		if t.arrival != nil {
+			delete(t.arrival, p.Key)
+		}
+		t.hooks.fireDelete(p.Key, p.Value)
+	}
+	for _, old := range updated {
+		if current, found := t.Search(old.Key); found {
+			t.hooks.fireUpdate(old.Key, old.Value, current)
+		}
+	}
+	return len(dropped)
+}
+
+// ReplaceAll swaps the whole contents of t for pairs in one step. The new tree
+// is bulk loaded off to the side and its root installed with a single
+// assignment, so t is never seen partly loaded. pairs may be in any order;
+// of pairs with equal keys the last wins. If the key validator refuses any
+// key, t is left unchanged and the error returned.
+//
+// Bookkeeping is reset as by Clear followed by inserting every pair: OnDelete
+// fires for each old entry, then OnInsert for each new one.
+func (t *BPlusTree[K, V]) ReplaceAll(pairs []Pair[K, V]) error {
+	if err := t.writable("replace"); err != nil {
+		return err
+	}
+	sorted := make([]Pair[K, V], len(pairs))
+	for i, p := range pairs {
+		key, value := t.copyIn(t.norm(p.Key), p.Value)
+		sorted[i] = Pair[K, V]{Key: key, Value: value}
+		if err := t.admit("replace", sorted[i].Key); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return t.less(sorted[i].Key, sorted[j].Key) })
+	kept := sorted[:0]
+	for _, p := range sorted {
+		if n := len(kept); n > 0 && t.equal(kept[n-1].Key, p.Key) {
+			kept[n-1] = p
+			continue
+		}
+		kept = append(kept, p)
+	}
+
+	b := &bulkBuilder[K, V]{tree: &BPlusTree[K, V]{order: t.order, less: t.less, equal: t.equal, alloc: t.alloc}}
+	b.expecting(len(kept))
+	for _, p := range kept {
+		b.add(p.Key, p.Value)
+	}
+	t.install(b.finish().root)
+	return nil
+}
+
+// install swaps root in as t's contents, which it replaces wholesale; see
+// ReplaceAll for the bookkeeping.
+func (t *BPlusTree[K, V]) install(root *BPlusTreeNode[K, V]) {
+	var removed []Pair[K, V]
+	if len(t.hooks.delete) > 0 {
+		t.ascend(func(k K, v V) bool {
+			removed = append(removed, Pair[K, V]{Key: k, Value: v})
+			return true
+		})
+	}
+	if t.root != nil && !t.cow {
+		freeAll(t.alloc, t.root)
+	}
+	t.root = root
+	t.cow = false
+	t.modCount++
+
+	if t.maxEntries > 0 {
+		t.lru.Init()
+		t.lruIndex = make(map[K]*list.Element)
+	}
+	if t.versions != nil {
+		t.versions = make(map[K]uint64)
+	}
+	if t.meta != nil {
+		t.meta = make(map[K]EntryMeta)
+	}
+	if t.access != nil {
+		t.access = make(map[K]int)
+	}
+	if t.arrival != nil {
+		t.arrival = make(map[K]uint64)
+	}
+	t.RebuildBloomFilter()
+	for _, p := range removed {
+		t.hooks.fireDelete(p.Key, p.Value)
+	}
+	// Hooks run after the walk, since one may write to the tree
+	var added []Pair[K, V]
+	t.ascend(func(k K, v V) bool {
+		t.recordWrite(k, true)
+		if t.maxEntries > 0 {
+			t.touch(k)
+		}
+		if len(t.hooks.insert) > 0 {
+			added = append(added, Pair[K, V]{Key: k, Value: v})
+		}
+		return true
+	})
+	for _, p := range added {
+		t.hooks.fireInsert(p.Key, p.Value)
+	}
+	if t.maxEntries > 0 {
+		t.evict()
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointer is the background state behind EnableAutoCheckpoint.
+type checkpointer struct {
+	every   int
+	path    string
+	pending int           // Writes since the last checkpoint, guarded by the tree's mutex
+	kick    chan struct{} // Signalled when pending reaches every
+	stop    chan struct{}
+	done    chan struct{}
+	err     error // Last failed checkpoint, read once done is closed
+}
+
+// EnableAutoCheckpoint saves the tree to path after every `every` writes and
+// every interval, whichever comes first; a zero value disables that trigger.
+// Saving happens on a background goroutine from a snapshot that shares the
+// tree's nodes, so the file is written without holding the lock. Taking the
+// snapshot is O(1), but the cost moves to the next write: because the nodes
+// are shared, the first write after each checkpoint copies the whole tree,
+// O(n), while holding the write lock. Close stops the goroutine after a
+// final checkpoint. Calling it again replaces the previous schedule; after
+// Close it returns ErrClosed.
+//
+// A checkpoint is a full Save, written to a temporary file and renamed over
+// path so a crash never leaves a torn file behind. The package keeps no
+// write-ahead log, so there is nothing to truncate afterwards; writes made
+// since the last checkpoint are lost on a crash.
+func (c *ConcurrentBPlusTree[K, V]) EnableAutoCheckpoint(every int, interval time.Duration, path string) error {
+	cp := &checkpointer{
+		every: every,
+		path:  path,
+		kick:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	old := c.ckpt
+	c.ckpt = cp
+	c.mu.Unlock()
+	if old != nil {
+		old.halt()
+	}
+	go c.runCheckpoints(cp, interval)
+	return nil
+}
+
+// Close shuts the tree down: writes made after it fail with ErrClosed, as
+// does closing again. If automatic checkpointing is on, Close waits for a
+// final, fsynced checkpoint of any outstanding writes and returns the last
+// checkpoint error, so nothing written before Close is lost.
+func (c *ConcurrentBPlusTree[K, V]) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.closed = true
+	cp := c.ckpt
+	c.ckpt = nil
+	c.mu.Unlock()
+	if cp == nil {
+		return nil
+	}
+	return cp.halt()
+}
+
+// wrote counts a write towards the next checkpoint. Callers hold c.mu.
+func (c *ConcurrentBPlusTree[K, V]) wrote() {
+	cp := c.ckpt
+	if cp == nil {
+		return
+	}
+	cp.pending++
+	if cp.every > 0 && cp.pending >= cp.every {
+		select {
+		case cp.kick <- struct{}{}:
+		default: // A checkpoint is already due
+		}
+	}
+}
+
+func (c *ConcurrentBPlusTree[K, V]) runCheckpoints(cp *checkpointer, interval time.Duration) {
+	defer close(cp.done)
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-cp.stop:
+			if err := c.checkpoint(cp); err != nil {
+				cp.err = err
+			}
+			return
+		case <-tick:
+		case <-cp.kick:
+		}
+		if err := c.checkpoint(cp); err != nil {
+			cp.err = err
+		}
+	}
+}
+
+// checkpoint saves a snapshot of the tree to cp.path if anything changed.
+func (c *ConcurrentBPlusTree[K, V]) checkpoint(cp *checkpointer) error {
+	c.mu.Lock()
+	if cp.pending == 0 {
+		c.mu.Unlock()
+		return nil
+	}
+	snap := c.tree.snapshot()
+	cp.pending = 0
+	c.mu.Unlock()
+
+	tmp, err := os.CreateTemp(filepath.Dir(cp.path), filepath.Base(cp.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+	if err := snap.Save(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cp.path)
+}
+
+// halt stops the goroutine and waits for its final checkpoint.
+func (cp *checkpointer) halt() error {
+	close(cp.stop)
+	<-cp.done
+	return cp.err
+}
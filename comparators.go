@@ -0,0 +1,99 @@
+package main
+
+import (
+	"cmp"
+	"strings"
+	"time"
+)
+
+// Ready-made less/equal pairs for common key types, so that
+// NewBPlusTree[int, V](3, IntLess, IntEqual) needs no hand-written closures.
+
+func StringLess(a, b string) bool  { return a < b }
+func StringEqual(a, b string) bool { return a == b }
+
+func IntLess(a, b int) bool  { return a < b }
+func IntEqual(a, b int) bool { return a == b }
+
+// Float64Less orders NaN before every other value so that, unlike a plain <,
+// it is a consistent ordering for keys. Float64Equal treats NaN as equal to itself
+// to match.
+func Float64Less(a, b float64) bool  { return cmp.Less(a, b) }
+func Float64Equal(a, b float64) bool { return cmp.Compare(a, b) == 0 }
+
+// TimeEqual compares instants with Equal rather than ==, which would also
+// compare the location and monotonic clock reading.
+func TimeLess(a, b time.Time) bool  { return a.Before(b) }
+func TimeEqual(a, b time.Time) bool { return a.Equal(b) }
+
+// Reverse returns the opposite ordering to less, for a tree that runs from
+// the largest key down; equal stays as it is. Everything ordered follows the
+// tree's ordering, so with it Min returns the logical maximum, iteration and
+// List go from high to low, and a range must be given high bound first:
+// RangeKeys(10, 1) returns 10 down to 1.
+func Reverse[K any](less func(K, K) bool) func(K, K) bool {
+	return func(a, b K) bool { return less(b, a) }
+}
+
+// Collation selects how string keys are ordered; Comparators turns it into the
+// less/equal pair for NewBPlusTree.
+type Collation int
+
+const (
+	CollateBytewise        Collation = iota // Plain byte order, as StringLess
+	CollateCaseInsensitive                  // Keys differing only in case are the same key
+	CollateNatural                          // Digit runs compare by value, so "file2" < "file10"
+)
+
+// Comparators returns the less and equal functions for c. Case-insensitive
+// collation only changes comparisons, so a key keeps the spelling it was first
+// inserted with; use WithKeyNormalizer(strings.ToLower) to fold stored keys too.
+func (c Collation) Comparators() (less func(a, b string) bool, equal func(a, b string) bool) {
+	switch c {
+	case CollateCaseInsensitive:
+		return func(a, b string) bool { return strings.ToLower(a) < strings.ToLower(b) },
+			func(a, b string) bool { return strings.ToLower(a) == strings.ToLower(b) }
+	case CollateNatural:
+		return NaturalLess, StringEqual
+	default:
+		return StringLess, StringEqual
+	}
+}
+
+// NaturalLess orders strings by comparing runs of ASCII digits by numeric value
+// and everything else byte by byte. Runs of equal value with different numbers
+// of leading zeros order the shorter first, so only identical strings compare
+// equal and StringEqual remains the matching equality.
+func NaturalLess(a, b string) bool { return naturalCompare(a, b) < 0 }
+
+func naturalCompare(a, b string) int {
+	isDigit := func(c byte) bool { return '0' <= c && c <= '9' }
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if !isDigit(a[i]) || !isDigit(b[j]) {
+			if a[i] != b[j] {
+				return cmp.Compare(a[i], b[j])
+			}
+			i, j = i+1, j+1
+			continue
+		}
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		na, nb := strings.TrimLeft(a[si:i], "0"), strings.TrimLeft(b[sj:j], "0")
+		if len(na) != len(nb) {
+			return cmp.Compare(len(na), len(nb)) // More significant digits is bigger
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(i-si, j-sj); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a)-i, len(b)-j)
+}
@@ -0,0 +1,245 @@
+package main
+
+import "sync"
+
+// ConcurrentBPlusTree guards a BPlusTree with a read/write mutex so it can be
+// shared between goroutines. View and Modify run arbitrary tree operations
+// under the lock for anything not wrapped here.
+//
+// After Close every write fails with ErrClosed; reads keep working on the
+// in-memory contents.
+type ConcurrentBPlusTree[K comparable, V any] struct {
+	mu     sync.RWMutex
+	tree   *BPlusTree[K, V]
+	ckpt   *checkpointer // Set by EnableAutoCheckpoint
+	closed bool
+
+	loads map[K]*pendingLoad[V] // GetOrLoad calls in flight, by normalized key
+}
+
+// pendingLoad lets later GetOrLoad callers for a key wait for the first one's
+// loader instead of running their own.
+type pendingLoad[V any] struct {
+	done  chan struct{} // Closed once value and found are set
+	value V
+	found bool
+}
+
+func NewConcurrentBPlusTree[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool, opts ...Option[K, V]) *ConcurrentBPlusTree[K, V] {
+	return &ConcurrentBPlusTree[K, V]{tree: NewBPlusTree[K, V](order, less, equal, opts...)}
+}
+
+// View calls fn with the tree under the read lock. fn must not modify the
+// tree, and anything it creates that reads nodes later, such as an Iterator,
+// is only valid until fn returns.
+func (c *ConcurrentBPlusTree[K, V]) View(fn func(t *BPlusTree[K, V])) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fn(c.tree)
+}
+
+// Modify calls fn with the tree under the write lock.
+func (c *ConcurrentBPlusTree[K, V]) Modify(fn func(t *BPlusTree[K, V])) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	fn(c.tree)
+	c.wrote()
+	return nil
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Insert(key K, value V) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.Insert(key, value)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+func (c *ConcurrentBPlusTree[K, V]) InsertUnique(key K, value V) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.InsertUnique(key, value)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+// GetOrInsert holds the write lock across the lookup and the insert, so
+// concurrent callers with the same key agree on a single stored value.
+func (c *ConcurrentBPlusTree[K, V]) GetOrInsert(key K, value V) (V, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return *new(V), false, ErrClosed
+	}
+	actual, loaded, err := c.tree.GetOrInsert(key, value)
+	if err == nil && !loaded {
+		c.wrote()
+	}
+	return actual, loaded, err
+}
+
+// GetOrLoad is BPlusTree.GetOrLoad with at most one load in flight per key:
+// callers missing the same key while a load runs wait for it and share its
+// result. load runs without any lock held, so other keys stay available, and
+// if it panics the waiters see a miss. After Close loaded values are returned
+// but no longer stored.
+func (c *ConcurrentBPlusTree[K, V]) GetOrLoad(key K, load func(K) (V, bool)) (V, bool) {
+	if value, found := c.Get(key); found {
+		return value, true
+	}
+
+	c.mu.Lock()
+	key = c.tree.norm(key)
+	if value, found := c.tree.Get(key); found { // Stored while we weren't holding the lock
+		c.mu.Unlock()
+		return value, true
+	}
+	if p, ok := c.loads[key]; ok {
+		c.mu.Unlock()
+		<-p.done
+		return p.value, p.found
+	}
+	if c.loads == nil {
+		c.loads = make(map[K]*pendingLoad[V])
+	}
+	p := &pendingLoad[V]{done: make(chan struct{})}
+	c.loads[key] = p
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		if p.found && !c.closed && c.tree.Insert(key, p.value) == nil {
+			c.wrote()
+		}
+		delete(c.loads, key)
+		c.mu.Unlock()
+		close(p.done)
+	}()
+	p.value, p.found = load(key)
+	return p.value, p.found
+}
+
+// ReplaceAll holds the write lock for the whole rebuild, so readers see
+// either the old contents or the new ones and never anything in between.
+func (c *ConcurrentBPlusTree[K, V]) ReplaceAll(pairs []Pair[K, V]) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.ReplaceAll(pairs)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+// Txn holds the write lock while fn runs and its writes are applied, so other
+// goroutines see all of them or none.
+func (c *ConcurrentBPlusTree[K, V]) Txn(fn func(tx *Txn[K, V]) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.Txn(fn)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Update(key K, value V) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.Update(key, value)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Delete(key K) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.Delete(key)
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	err := c.tree.Clear()
+	if err == nil {
+		c.wrote()
+	}
+	return err
+}
+
+// Get takes the write lock when the tree tracks LRU recency or access
+// counts, since a read then updates them.
+func (c *ConcurrentBPlusTree[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	if c.tree.maxEntries == 0 && c.tree.access == nil {
+		defer c.mu.RUnlock()
+		return c.tree.Get(key)
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.Get(key)
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Exists(key K) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.Exists(key)
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Count() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.Count()
+}
+
+func (c *ConcurrentBPlusTree[K, V]) Range(start K, end K) map[K]V {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.Range(start, end)
+}
+
+// SnapshotIterator returns an iterator over the current contents that stays
+// valid, and unaffected, while other goroutines write to the tree, so it can
+// be used without holding any lock.
+func (c *ConcurrentBPlusTree[K, V]) SnapshotIterator() *Iterator[K, V] {
+	// The write lock, because taking a snapshot marks the tree copy-on-write
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tree.SnapshotIterator()
+}
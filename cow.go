@@ -0,0 +1,207 @@
+package main
+
+import "container/list"
+
+// WithInsert returns a new tree holding key -> value in addition to the
+// contents of t, leaving t unmodified. Only the nodes on the path from the
+// root to the affected leaf are copied; everything else is shared.
+//
+// Shared leaves can't carry a next link that is right for both versions, so
+// trees that share nodes step between leaves by descending from the root
+// instead, and the first in-place mutation of such a tree (Insert, Delete,
+// ...) first takes a private copy of every node.
+func (t *BPlusTree[K, V]) WithInsert(key K, value V) *BPlusTree[K, V] {
+	key, value = t.copyIn(t.norm(key), value)
+	nt := *t
+	nt.cow, t.cow = true, true
+	nt.frozen = false                // A new tree, writable even if t is frozen
+	nt.hooks = mutationHooks[K, V]{} // Hooks track t; the new version starts without any
+	if t.maxEntries > 0 {
+		nt.lru = list.New()
+		nt.lruIndex = make(map[K]*list.Element)
+		for e := t.lru.Back(); e != nil; e = e.Prev() {
+			nt.touch(e.Value.(K))
+		}
+	}
+
+	if t.versions != nil {
+		nt.versions = make(map[K]uint64, len(t.versions))
+		for k, v := range t.versions {
+			nt.versions[k] = v
+		}
+	}
+
+	if t.meta != nil {
+		nt.meta = make(map[K]EntryMeta, len(t.meta))
+		for k, m := range t.meta {
+			nt.meta[k] = m
+		}
+	}
+
+	if t.access != nil {
+		nt.access = make(map[K]int, len(t.access))
+		for k, n := range t.access {
+			nt.access[k] = n
+		}
+	}
+
+	if t.arrival != nil {
+		nt.arrival = make(map[K]uint64, len(t.arrival))
+		for k, seq := range t.arrival {
+			nt.arrival[k] = seq
+		}
+	}
+
+	if t.bloom != nil {
+		nt.bloom = t.bloom.clone()
+	}
+
+	if t.root == nil {
+		nt.root = newBPlusTreeNode(t.alloc, t.order)
+	} else {
+		nt.root = cloneNode(t.alloc, t.root)
+	}
+
+	if leaf, idx := nt.copyPathTo(key); leaf != nil {
+		leaf.values[idx] = value
+		if nt.maxEntries > 0 {
+			nt.touch(key)
+		}
+		nt.recordWrite(key, false)
+		return &nt
+	}
+
+	root := nt.root
+	if len(root.keys) == 2*(nt.order-1) {
+		newRoot := newBPlusTreeNode(nt.alloc, nt.order)
+		newRoot.isLeaf = false
+		newRoot.children = append(newRoot.children, root)
+		newRoot.splitChild(0, nt.less, nt.alloc, &nt.obs)
+		root = newRoot
+		nt.root = newRoot
+	}
+	// Same descent as insertNonFull, but every node is copied before it changes
+	current := root
+	for !current.isLeaf {
+		i := current.childIndex(key, nt.less)
+		current.children[i] = cloneNode(t.alloc, current.child(i))
+		if len(current.child(i).keys) == 2*(nt.order-1) {
+			current.splitChild(i, nt.less, nt.alloc, &nt.obs)
+			if !nt.less(key, current.keys[i]) {
+				i++
+			}
+		}
+		current = current.child(i)
+	}
+	current.insertNonFull(key, value, nt.less, nt.alloc, &nt.obs)
+	nt.bloomAdd(key)
+	nt.recordWrite(key, true)
+
+	if nt.maxEntries > 0 {
+		nt.touch(key)
+		nt.evict()
+	}
+	return &nt
+}
+
+// copyPathTo copies every node from the (already copied) root down to the
+// leaf that holds key, and returns that leaf and the key's index in it, or
+// nil if key is absent. Nothing is copied when the key is absent.
+func (t *BPlusTree[K, V]) copyPathTo(key K) (*BPlusTreeNode[K, V], int) {
+	if node, _ := t.locate(key); node == nil {
+		return nil, 0
+	}
+	current := t.root
+	for !current.isLeaf {
+		i := current.childIndex(key, t.less)
+		current.children[i] = cloneNode(t.alloc, current.child(i))
+		current = current.child(i)
+	}
+	return current, current.findKey(key, t.less)
+}
+
+// cloneNode copies a single node, giving it its own key, value and child
+// slices. Children themselves are shared.
+func cloneNode[K comparable, V any](alloc Allocator[K, V], n *BPlusTreeNode[K, V]) *BPlusTreeNode[K, V] {
+	c := newBPlusTreeNode(alloc, n.order)
+	c.isLeaf = n.isLeaf
+	c.next = n.next
+	c.keys = append(c.keys, n.keys...)
+	c.values = append(c.values, n.values...)
+	c.children = append(c.children, n.children...)
+	if n.src != nil {
+		// Not read yet: the copy reads the same page when first reached
+		c.page, c.src = n.page, n.src
+	}
+	return c
+}
+
+// own gives t a private copy of all of its nodes if it shares any with another
+// version, relinking the leaf chain so in-place mutation is safe again.
+func (t *BPlusTree[K, V]) own() {
+	if !t.cow {
+		return
+	}
+	var prev *BPlusTreeNode[K, V]
+	var copyAll func(n *BPlusTreeNode[K, V]) *BPlusTreeNode[K, V]
+	copyAll = func(n *BPlusTreeNode[K, V]) *BPlusTreeNode[K, V] {
+		c := cloneNode(t.alloc, n)
+		if c.isLeaf {
+			c.next = nil
+			if prev != nil {
+				prev.next = c
+			}
+			prev = c
+			return c
+		}
+		for i, child := range c.children {
+			c.children[i] = copyAll(child)
+		}
+		return c
+	}
+	if t.root != nil {
+		t.root = copyAll(t.root)
+	}
+	t.cow = false
+}
+
+// nextLeaf returns the leaf after n in key order. For trees sharing nodes
+// with another version the stored link may belong to the other version, and
+// in a tree opened with OpenPages leaves aren't linked as they're read, so in
+// both the successor is found from the root via n's last key.
+func (t *BPlusTree[K, V]) nextLeaf(n *BPlusTreeNode[K, V]) *BPlusTreeNode[K, V] {
+	if !t.cow && t.pages == nil {
+		return n.next
+	}
+	if len(n.keys) == 0 {
+		return nil // Only an empty root leaf has no keys
+	}
+	last := n.keys[len(n.keys)-1]
+	var successor *BPlusTreeNode[K, V]
+	for current := t.root; !current.isLeaf; {
+		i := current.childIndex(last, t.less)
+		if i < len(current.children)-1 {
+			successor = current.child(i + 1)
+		}
+		current = current.child(i)
+	}
+	for successor != nil && !successor.isLeaf {
+		successor = successor.child(0)
+	}
+	return successor
+}
+
+// snapshot returns a read-only view of t's current contents sharing all of
+// its nodes. Both are marked copy-on-write, so t copies before its next write
+// rather than changing nodes the snapshot can see.
+func (t *BPlusTree[K, V]) snapshot() *BPlusTree[K, V] {
+	t.cow = true
+	return &BPlusTree[K, V]{
+		root:  t.root,
+		order: t.order,
+		less:  t.less,
+		equal: t.equal,
+		alloc: t.alloc,
+		cow:   true,
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned (usually wrapped with the offending key or value)
+// by the tree's methods; test for them with errors.Is.
+var (
+	ErrKeyExists    = errors.New("key already exists")
+	ErrKeyNotFound  = errors.New("key not found")
+	ErrEmptyTree    = errors.New("tree is empty")
+	ErrInvalidOrder = errors.New("invalid order")
+	ErrInvalidKey   = errors.New("invalid key")
+
+	ErrUnsortedInput = errors.New("input not sorted by key")
+
+	ErrConcurrentModification = errors.New("tree modified during iteration")
+
+	ErrClosed = errors.New("tree is closed")
+	ErrFrozen = errors.New("tree is frozen")
+
+	ErrInvalidFormat  = errors.New("not a saved tree")
+	ErrUnknownVersion = errors.New("unknown format version")
+	ErrPageNotFound   = errors.New("page not found")
+	ErrCorruptPage    = errors.New("corrupt page")
+	ErrNotPaged       = errors.New("tree not opened from a page store")
+)
+
+// minOrder is the smallest order whose split internal nodes keep a key on
+// each side.
+const minOrder = 3
+
+func checkOrder(order int) error {
+	if order < minOrder {
+		return fmt.Errorf("%w: %d, must be at least %d", ErrInvalidOrder, order, minOrder)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import "fmt"
+
+// Freeze makes the tree read-only, e.g. once a reference dataset has been
+// bulk loaded, so a stray write shows up as a bug rather than silently
+// changing the data. Writes that return an error (Insert, InsertUnique,
+// InsertTracked, Update, BatchInsert, BulkUpsert, AppendSorted, Delete,
+// Clear, ReplaceAll, LoadSortedFile, Txn, and GetOrInsert when the key is
+// absent) fail with ErrFrozen; those with no error result to report it
+// through (Replace when it is present, Remove, BatchDelete, DeleteCompact,
+// DeleteWhere, DeletePrefix, Drain, Reindex, SetMaxEntries) panic with it.
+// Reads are unaffected. WithInsert still builds new versions, leaving the
+// frozen tree as it is; the versions it returns are not frozen.
+func (t *BPlusTree[K, V]) Freeze() {
+	t.frozen = true
+}
+
+// Unfreeze makes a frozen tree writable again.
+func (t *BPlusTree[K, V]) Unfreeze() {
+	t.frozen = false
+}
+
+// Frozen reports whether Freeze is in effect.
+func (t *BPlusTree[K, V]) Frozen() bool {
+	return t.frozen
+}
+
+// writable returns ErrFrozen, naming op, if the tree is frozen.
+func (t *BPlusTree[K, V]) writable(op string) error {
+	if t.frozen {
+		return fmt.Errorf("%s: %w", op, ErrFrozen)
+	}
+	return nil
+}
+
+// mustWritable is writable for methods with no error result.
+func (t *BPlusTree[K, V]) mustWritable(op string) {
+	if err := t.writable(op); err != nil {
+		panic(err)
+	}
+}
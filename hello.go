@@ -2,9 +2,18 @@ package main
 
 import (
 	"bufio"
+	"container/list"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
 	"os"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -16,6 +25,11 @@ type BPlusTreeNode[K comparable, V any] struct {
 	isLeaf   bool
 	next     *BPlusTreeNode[K, V] // Link to the next leaf node for easier traversal
 	order    int
+
+	// Paged trees only, see OpenPages: the page the node was read from, and
+	// while it has not been read yet, where to read it from
+	page PageID
+	src  *pageSource[K, V]
 }
 
 type BPlusTree[K comparable, V any] struct {
@@ -23,29 +37,106 @@ type BPlusTree[K comparable, V any] struct {
 	order int
 	less  func(K, K) bool
 	equal func(K, K) bool
+
+	// LRU bookkeeping, only used once SetMaxEntries enables a bound
+	maxEntries int
+	lru        *list.List // Front is the most recently used key
+	lruIndex   map[K]*list.Element
+
+	cow    bool // Shares nodes with another version made by WithInsert
+	alloc  Allocator[K, V]
+	frozen bool // Writes refused, see Freeze
+
+	// modCount counts structural changes (keys added or removed) so iterators
+	// can detect that the tree changed under them
+	modCount uint64
+
+	hooks mutationHooks[K, V]
+
+	// Per-key write versions, only tracked once EnableVersioning is called
+	versions map[K]uint64
+	writeSeq uint64
+
+	meta   map[K]EntryMeta // Timestamps, only tracked with WithTimestamps
+	access map[K]int       // Get hits per key, only tracked with WithAccessTracking
+	bloom  *bloomFilter    // Keys ever inserted, only kept with EnableBloomFilter
+
+	sortKeys *sortKeyCache[K] // Set by WithSortKey, which defines key identity
+
+	pages *pageSource[K, V] // Where unread nodes come from, for trees opened with OpenPages
+
+	// Per-key insertion sequence numbers, only tracked with WithInsertionOrder
+	arrival    map[K]uint64
+	arrivalSeq uint64
+
+	obs observer // Split and merge counts and debug events, see SplitCount and SetLogger
+
+	normalize    func(K) K     // Applied to every key argument, see WithKeyNormalizer
+	keyValidator func(K) error // Vets keys before they are written, see WithKeyValidator
+
+	// Copies taken of keys and values as they are stored, see WithCopyOnInsert
+	copyKey   func(K) K
+	copyValue func(V) V
+
+	// Encodings ContentHash hashes, see WithContentEncoding
+	hashKey   func(K) []byte
+	hashValue func(V) []byte
+
+	// Key codec for ScanFrom cursors, set with SetCursorCodec
+	encodeKey func(K) []byte
+	decodeKey func([]byte) (K, error)
 }
 
-func newBPlusTreeNode[K comparable, V any](order int) *BPlusTreeNode[K, V] {
-	return &BPlusTreeNode[K, V]{
-		keys:     []K{},
-		values:   []V{},
-		children: []*BPlusTreeNode[K, V]{},
-		isLeaf:   true,
-		order:    order,
-		next:     nil,
-	}
+// Interval is an inclusive key range [Start, End].
+type Interval[K comparable] struct {
+	Start K
+	End   K
 }
 
-func NewBPlusTree[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool) *BPlusTree[K, V] {
-	return &BPlusTree[K, V]{
-		root:  newBPlusTreeNode[K, V](order),
+// Pair is a single key-value entry returned by the ordered query methods.
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// newBPlusTreeNode gets an empty leaf from alloc. Recycled nodes keep the
+// capacity of their slices, which is much of the point of reusing them.
+func newBPlusTreeNode[K comparable, V any](alloc Allocator[K, V], order int) *BPlusTreeNode[K, V] {
+	n := alloc.AllocNode()
+	n.keys = n.keys[:0]
+	n.values = n.values[:0]
+	n.children = n.children[:0]
+	n.isLeaf = true
+	n.next = nil
+	n.order = order
+	n.page, n.src = 0, nil
+	return n
+}
+
+// NewBPlusTree creates an empty tree. It panics with ErrInvalidOrder if order
+// is below 3, as such a tree could not split its nodes. Values are stored
+// inline in the leaves, so an insert or delete shifts up to 2*(order-1)
+// whole values and a split copies half of them; for value types much bigger
+// than a few words, store pointers to them instead (see
+// BenchmarkLargeValues).
+func NewBPlusTree[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool, opts ...Option[K, V]) *BPlusTree[K, V] {
+	if err := checkOrder(order); err != nil {
+		panic(err)
+	}
+	t := &BPlusTree[K, V]{
 		order: order,
 		less:  less,
 		equal: equal,
+		alloc: heapAllocator[K, V]{},
+	}
+	for _, opt := range opts {
+		opt(t)
 	}
+	t.root = newBPlusTreeNode(t.alloc, order)
+	return t
 }
 
-func (n *BPlusTreeNode[K, V]) insertNonFull(k K, v V, less func(K, K) bool) {
+func (n *BPlusTreeNode[K, V]) insertNonFull(k K, v V, less func(K, K) bool, alloc Allocator[K, V], obs *observer) {
 	i := len(n.keys) - 1
 
 	if n.isLeaf {
@@ -63,364 +154,2196 @@ func (n *BPlusTreeNode[K, V]) insertNonFull(k K, v V, less func(K, K) bool) {
 			i--
 		}
 		i++
-		if len(n.children[i].keys) == 2*(n.order-1) {
-			n.splitChild(i, less)
-			if less(n.keys[i], k) {
+		if len(n.child(i).keys) == 2*(n.order-1) {
+			n.splitChild(i, less, alloc, obs)
+			// Keys equal to the new separator belong to its right
+			if !less(k, n.keys[i]) {
 				i++
 			}
 		}
-		n.children[i].insertNonFull(k, v, less)
+		n.child(i).insertNonFull(k, v, less, alloc, obs)
 	}
 }
 
-func (n *BPlusTreeNode[K, V]) splitChild(i int, less func(K, K) bool) {
+// splitChild splits the full child at index i in two and adds a separator to n.
+// A leaf keeps every key, so the right half's first key is copied up; an
+// internal node gives its middle key up to n.
+func (n *BPlusTreeNode[K, V]) splitChild(i int, less func(K, K) bool, alloc Allocator[K, V], obs *observer) {
 	order := n.order
-	y := n.children[i]
-	z := newBPlusTreeNode[K, V](order)
+	y := n.child(i)
+	z := newBPlusTreeNode(alloc, order)
 	z.isLeaf = y.isLeaf
-	z.keys = append(z.keys, y.keys[order:]...)
-	z.values = append(z.values, y.values[order:]...)
-	y.keys = y.keys[:order-1]
-	y.values = y.values[:order-1]
 
+	var separator K
 	if y.isLeaf {
+		// 2*(order-1) keys split evenly, order-1 on each side
+		z.keys = append(z.keys, y.keys[order-1:]...)
+		z.values = append(z.values, y.values[order-1:]...)
+		y.keys = y.keys[:order-1]
+		y.values = y.values[:order-1]
+		separator = z.keys[0]
+
 		// Correctly link the leaf nodes
 		z.next = y.next
 		y.next = z
+	} else {
+		// order-1 keys stay left and order-2 go right, with the middle one
+		// moving up; minOrder keeps the right side from coming up empty
+		separator = y.keys[order-1]
+		z.keys = append(z.keys, y.keys[order:]...)
+		z.children = append(z.children, y.children[order:]...)
+		y.keys = y.keys[:order-1]
+		y.children = y.children[:order]
+	}
+	n.children = append(n.children[:i+1], append([]*BPlusTreeNode[K, V]{z}, n.children[i+1:]...)...)
+	n.keys = append(n.keys[:i], append([]K{separator}, n.keys[i:]...)...)
+	obs.split(y.isLeaf, separator, len(y.keys), len(z.keys))
+}
+
+// Search function to check if a key already exists
+func (t *BPlusTree[K, V]) Search(key K) (V, bool) {
+	key = t.norm(key)
+	if t.bloomExcludes(key) {
+		return *new(V), false
+	}
+	if node, idx := t.locate(key); node != nil {
+		return node.values[idx], true
+	}
+	return *new(V), false // Return false if the key is not found
+}
+
+// norm applies the key normalizer, if any. Public methods call it on their
+// key arguments; internal helpers take keys as stored.
+func (t *BPlusTree[K, V]) norm(key K) K {
+	if t.normalize == nil {
+		return key
+	}
+	return t.normalize(key)
+}
+
+// locate returns the node holding key and its index there, or nil if absent.
+func (t *BPlusTree[K, V]) locate(key K) (*BPlusTreeNode[K, V], int) {
+	current := t.root
+	if current == nil {
+		return nil, 0
+	}
+	// Internal keys are only separators; every key lives in a leaf. Keys equal
+	// to a separator sit in the subtree to its right.
+	for !current.isLeaf {
+		idx := 0
+		for idx < len(current.keys) && !t.less(key, current.keys[idx]) {
+			idx++
+		}
+		current = current.child(idx)
+	}
+
+	idx := current.findKey(key, t.less)
+	if idx < len(current.keys) && t.equal(current.keys[idx], key) {
+		return current, idx
+	}
+	return nil, 0
+}
+
+// Insert stores value under key, overwriting the value of an existing key the
+// way a map assignment does. Use InsertUnique to reject duplicates instead.
+// The only error is a key refused by the tree's key validator.
+func (t *BPlusTree[K, V]) Insert(key K, value V) error {
+	key = t.norm(key)
+	if err := t.admit("insert", key); err != nil {
+		return err
+	}
+	t.own()
+	if node, idx := t.locate(key); node != nil {
+		t.replace(node, idx, value)
+		return nil
+	}
+	t.insert(key, value)
+	return nil
+}
+
+// replace overwrites the value at node.values[idx], in a tree already owned,
+// with the bookkeeping of an update.
+func (t *BPlusTree[K, V]) replace(node *BPlusTreeNode[K, V], idx int, value V) {
+	if t.copyValue != nil {
+		value = t.copyValue(value)
+	}
+	key, old := node.keys[idx], node.values[idx]
+	node.values[idx] = value
+	if t.maxEntries > 0 {
+		t.touch(key)
+	}
+	t.recordWrite(key, false)
+	if t.obs.logger != nil {
+		t.obs.logger("insert", map[string]any{"key": key, "created": false})
+	}
+	t.hooks.fireUpdate(key, old, value)
+}
+
+// copyIn returns the copies of key and value the tree should store, as set
+// up by WithCopyOnInsert.
+func (t *BPlusTree[K, V]) copyIn(key K, value V) (K, V) {
+	if t.copyKey != nil {
+		key = t.copyKey(key)
+	}
+	if t.copyValue != nil {
+		value = t.copyValue(value)
+	}
+	return key, value
+}
+
+// admit refuses a key about to be written by op if the tree is frozen, then
+// runs the key validator on it, if any.
+func (t *BPlusTree[K, V]) admit(op string, key K) error {
+	if t.frozen {
+		return fmt.Errorf("%s '%v': %w", op, key, ErrFrozen)
+	}
+	if t.keyValidator == nil {
+		return nil
+	}
+	if err := t.keyValidator(key); err != nil {
+		return fmt.Errorf("%s '%v': %w: %w", op, key, ErrInvalidKey, err)
+	}
+	return nil
+}
+
+// InsertUnique inserts key only if it is not already present, returning an
+// error and leaving the tree unchanged otherwise.
+func (t *BPlusTree[K, V]) InsertUnique(key K, value V) error {
+	key = t.norm(key)
+	if err := t.admit("insert", key); err != nil {
+		return err
+	}
+	if _, found := t.Search(key); found {
+		return fmt.Errorf("insert '%v': %w", key, ErrKeyExists)
+	}
+	t.insert(key, value)
+	return nil
+}
+
+// OnDuplicate chooses what BatchInsert does with a key that is already present,
+// including one inserted earlier in the same batch.
+type OnDuplicate int
+
+const (
+	DuplicateSkip      OnDuplicate = iota // Keep the stored value
+	DuplicateOverwrite                    // Replace it, as Insert does
+	DuplicateFail                         // Stop with an ErrKeyExists error
+)
+
+// BatchInsert inserts pairs in order, handling keys already present according
+// to onDup, and counts what happened to each pair. With DuplicateFail, or if
+// the key validator refuses a key, it stops at that pair and returns the
+// error; pairs before it stay inserted.
+func (t *BPlusTree[K, V]) BatchInsert(pairs []Pair[K, V], onDup OnDuplicate) (inserted, skipped, overwritten int, err error) {
+	if err := t.writable("insert"); err != nil {
+		return 0, 0, 0, err
+	}
+	for _, p := range pairs {
+		if !t.Exists(p.Key) {
+			if err := t.Insert(p.Key, p.Value); err != nil {
+				return inserted, skipped, overwritten, err
+			}
+			inserted++
+			continue
+		}
+		switch onDup {
+		case DuplicateSkip:
+			skipped++
+		case DuplicateOverwrite:
+			t.Insert(p.Key, p.Value) // Already present, so already validated
+			overwritten++
+		default:
+			return inserted, skipped, overwritten, fmt.Errorf("insert '%v': %w", t.norm(p.Key), ErrKeyExists)
+		}
+	}
+	return inserted, skipped, overwritten, nil
+}
+
+// sortedBatch checks a batch of pairs for op before anything is written: the
+// tree must be writable, and the normalized keys, which it returns, must pass
+// the key validator and strictly increase, or it fails with ErrUnsortedInput.
+func (t *BPlusTree[K, V]) sortedBatch(op string, pairs []Pair[K, V]) ([]K, error) {
+	if err := t.writable(op); err != nil {
+		return nil, err
+	}
+	keys := make([]K, len(pairs))
+	for i, p := range pairs {
+		keys[i] = t.norm(p.Key)
+		if err := t.admit(op, keys[i]); err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			if err := follows(t.less, keys[i-1], keys[i]); err != nil {
+				return nil, fmt.Errorf("%s: pair %d: %w", op, i, err)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// BulkUpsert applies a batch of pairs sorted by strictly increasing key,
+// overwriting keys already present and inserting the rest, checking the whole
+// batch before anything changes. Rather than descending from the root for
+// every pair, it merge-walks the batch against the leaf chain from the first
+// key, so a run of updates costs one pass over the leaves it covers; only an
+// insert descends again, since it may split nodes along its path.
+func (t *BPlusTree[K, V]) BulkUpsert(sorted []Pair[K, V]) error {
+	keys, err := t.sortedBatch("upsert", sorted)
+	if err != nil {
+		return err
+	}
+	if len(sorted) == 0 {
+		return nil
+	}
+
+	t.own()
+	if t.root == nil {
+		t.root = newBPlusTreeNode(t.alloc, t.order)
+	}
+	leaf, i := t.seek(keys[0])
+	for n, key := range keys {
+		for leaf != nil && i == len(leaf.keys) {
+			leaf, i = t.nextLeaf(leaf), 0
+		}
+		for leaf != nil && t.less(leaf.keys[i], key) {
+			if i++; i == len(leaf.keys) {
+				leaf, i = t.nextLeaf(leaf), 0
+			}
+		}
+		modCount := t.modCount
+		if leaf != nil && t.equal(leaf.keys[i], key) {
+			t.replace(leaf, i, sorted[n].Value)
+		} else {
+			t.insert(key, sorted[n].Value)
+		}
+		// An insert, or a hook writing to the tree, may have moved keys
+		// between leaves, so find the place again
+		if t.modCount != modCount {
+			leaf, i = t.seek(key)
+		}
+	}
+	return nil
+}
+
+// GetOrInsert returns the value stored under key with loaded set to true, or,
+// if key is absent, inserts value and returns it with loaded false, like
+// sync.Map's LoadOrStore. A hit counts as a read, as with Get. Inserting
+// fails with the error Insert would return, for a frozen tree or a key the
+// validator refuses.
+//
+// A miss inserts from the path the lookup took rather than descending again,
+// unless the tree still shares nodes with a snapshot and has to copy them.
+func (t *BPlusTree[K, V]) GetOrInsert(key K, value V) (actual V, loaded bool, err error) {
+	key = t.norm(key)
+	var path []*BPlusTreeNode[K, V]
+	for n := t.root; n != nil; n = n.child(n.childIndex(key, t.less)) {
+		path = append(path, n)
+		if n.isLeaf {
+			break
+		}
+	}
+	if len(path) > 0 {
+		leaf := path[len(path)-1]
+		if i := leaf.findKey(key, t.less); i < len(leaf.keys) && t.equal(leaf.keys[i], key) {
+			t.read(key)
+			return leaf.values[i], true, nil
+		}
+	}
+	if err := t.admit("insert", key); err != nil {
+		return *new(V), false, err
+	}
+	full := func(n *BPlusTreeNode[K, V]) bool { return len(n.keys) == 2*(t.order-1) }
+	if t.cow || len(path) == 0 || full(path[0]) {
+		t.insert(key, value)
+		return value, false, nil
+	}
+	// Inserting splits every full node on the way down, so it can start from
+	// the last node on the path above the first full one
+	start := path[0]
+	for _, n := range path[1:] {
+		if full(n) {
+			break
+		}
+		start = n
+	}
+	key, value = t.copyIn(key, value)
+	start.insertNonFull(key, value, t.less, t.alloc, &t.obs)
+	t.inserted(key, value)
+	return value, false, nil
+}
+
+// InsertTracked is Insert that also reports whether the root split, growing
+// the tree by a level. Overwriting an existing key never grows it.
+func (t *BPlusTree[K, V]) InsertTracked(key K, value V) (grew bool, err error) {
+	key = t.norm(key)
+	if err := t.admit("insert", key); err != nil {
+		return false, err
+	}
+	if _, found := t.Search(key); found {
+		t.Insert(key, value)
+		return false, nil
+	}
+	return t.insert(key, value), nil
+}
+
+// GetOrLoad returns the value under key like Get, or on a miss asks load for
+// it, storing and returning what load finds. It reports false only if the key
+// is absent and load found nothing either. A value the key validator refuses
+// is still returned, just not stored.
+func (t *BPlusTree[K, V]) GetOrLoad(key K, load func(K) (V, bool)) (V, bool) {
+	if value, found := t.Get(key); found {
+		return value, true
+	}
+	value, found := load(key)
+	if found {
+		t.Insert(key, value)
 	}
+	return value, found
+}
+
+// insert adds a key known to be absent from the tree and reports whether the
+// root had to split.
+func (t *BPlusTree[K, V]) insert(key K, value V) (grew bool) {
+	key, value = t.copyIn(key, value)
+	t.own()
+	if t.root == nil {
+		t.root = newBPlusTreeNode(t.alloc, t.order)
+	}
+	root := t.root
+	if len(root.keys) == 2*(t.order-1) {
+		newRoot := newBPlusTreeNode(t.alloc, t.order)
+		newRoot.isLeaf = false
+		newRoot.children = append(newRoot.children, root)
+		newRoot.splitChild(0, t.less, t.alloc, &t.obs)
+		newRoot.insertNonFull(key, value, t.less, t.alloc, &t.obs)
+		t.root = newRoot
+		grew = true
+	} else {
+		root.insertNonFull(key, value, t.less, t.alloc, &t.obs)
+	}
+	t.inserted(key, value)
+	return grew
+}
+
+// inserted does the bookkeeping for a key just added to the tree.
+func (t *BPlusTree[K, V]) inserted(key K, value V) {
+	t.modCount++
+	t.bloomAdd(key)
+	t.recordWrite(key, true)
+	if t.obs.logger != nil {
+		t.obs.logger("insert", map[string]any{"key": key, "created": true})
+	}
+	t.hooks.fireInsert(key, value)
+
+	if t.maxEntries > 0 {
+		t.touch(key)
+		t.evict()
+	}
+}
+
+// AppendSorted adds pairs whose keys all come after every key in the tree:
+// the append-only ingestion path. Each pair goes straight onto the last leaf,
+// with a descent only when that leaf is full and must split, about once per
+// order-1 pairs. The batch is checked as by BulkUpsert, and a first key not
+// past the tree's largest also fails with ErrUnsortedInput.
+func (t *BPlusTree[K, V]) AppendSorted(pairs []Pair[K, V]) error {
+	keys, err := t.sortedBatch("append", pairs)
+	if err != nil {
+		return err
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+	if last, _, err := t.Max(); err == nil {
+		if err := follows(t.less, last, keys[0]); err != nil {
+			return fmt.Errorf("append: past the tree's largest key: %w", err)
+		}
+	}
+
+	t.own()
+	if t.root == nil {
+		t.root = newBPlusTreeNode(t.alloc, t.order)
+	}
+	maxKeys := 2 * (t.order - 1)
+	leaf := t.rightmostLeaf()
+	for i, key := range keys {
+		if len(leaf.keys) == maxKeys {
+			t.insert(key, pairs[i].Value)
+			leaf = t.rightmostLeaf() // The split made a new last leaf
+			continue
+		}
+		expected := t.modCount + 1
+		key, value := t.copyIn(key, pairs[i].Value)
+		leaf.keys = append(leaf.keys, key)
+		leaf.values = append(leaf.values, value)
+		t.inserted(key, value)
+		if t.modCount != expected {
+			leaf = t.rightmostLeaf() // A hook or eviction changed the tree too
+		}
+	}
+	return nil
+}
+
+func (t *BPlusTree[K, V]) Traverse() {
+	if t.root == nil {
+		fmt.Println("Tree is empty")
+		return
+	}
+
+	// Start at the leftmost leaf
+	current := t.root
+	for !current.isLeaf {
+		current = current.child(0)
+	}
+
+	// Table header
+	fmt.Println(strings.Repeat("-", 80))
+	fmt.Printf("%-6s | %-10s | %-10s\n", "Index", "Key", "Value")
+	fmt.Println(strings.Repeat("-", 80))
+
+	// Traverse through the linked list of leaf nodes
+	index := 0
+	for current != nil {
+		for i := 0; i < len(current.keys); i++ {
+			// Print in table format: Index, Key, Value
+			fmt.Printf("%-6d | %-10v | %-10v\n", index, current.keys[i], current.values[i])
+			fmt.Println(strings.Repeat(".", 80))
+			index++
+		}
+		current = t.nextLeaf(current)
+	}
+}
+
+// Delete removes key if present. The only error is ErrFrozen.
+func (t *BPlusTree[K, V]) Delete(key K) error {
+	key = t.norm(key)
+	if err := t.writable("delete"); err != nil {
+		return err
+	}
+	t.remove(key)
+	return nil
+}
+
+// Remove deletes key like Delete and returns the value it held, reporting
+// false if the key was absent. It panics with ErrFrozen on a frozen tree.
+func (t *BPlusTree[K, V]) Remove(key K) (V, bool) {
+	key = t.norm(key)
+	t.mustWritable("delete")
+	return t.remove(key)
+}
+
+// remove does the work of Delete and Remove on a normalized key.
+func (t *BPlusTree[K, V]) remove(key K) (V, bool) {
+	value, found := t.Search(key)
+	if !found {
+		return value, false
+	}
+	t.own()
+	t.modCount++
+	t.root.deleteKey(key, t.order, t.less, t.equal, t.alloc, &t.obs)
+	t.forget(key)
+	if t.versions != nil {
+		delete(t.versions, key)
+	}
+	if t.meta != nil {
+		delete(t.meta, key)
+	}
+	if t.access != nil {
+		delete(t.access, key)
+	}
+	if t.arrival != nil {
+		delete(t.arrival, key)
+	}
+
+	// An empty leaf root is left in place so the tree stays usable
+	if len(t.root.keys) == 0 && !t.root.isLeaf {
+		old := t.root
+		t.root = t.root.child(0)
+		t.alloc.FreeNode(old)
+	}
+	if t.obs.logger != nil {
+		t.obs.logger("delete", map[string]any{"key": key})
+	}
+	t.hooks.fireDelete(key, value)
+	return value, true
+}
+
+// DeleteCompact removes key like Delete, then merges neighbouring nodes along
+// the key's path wherever two of them fit in one node. Delete only merges when
+// a node would underflow, so a tree that shrinks settles with nodes near the
+// minimum; DeleteCompact spends extra merges on each delete to keep nodes
+// fuller, giving scans fewer leaves to walk and possibly a shorter tree. It
+// suits read-heavy trees; under mixed workloads the fuller nodes just split
+// again sooner on the next inserts.
+func (t *BPlusTree[K, V]) DeleteCompact(key K) {
+	key = t.norm(key)
+	t.mustWritable("delete")
+	if _, found := t.Search(key); !found {
+		return
+	}
+	t.Delete(key)
+
+	maxKeys := 2 * (t.order - 1)
+	for n := t.root; !n.isLeaf; {
+		idx := n.childIndex(key, t.less)
+		// A merge takes a key from n, so only do it while n can spare one
+		if n == t.root || len(n.keys) > t.order-2 {
+			idx = n.compactChild(idx, maxKeys, t.order, t.alloc, &t.obs)
+		}
+		n = n.child(idx)
+	}
+	for len(t.root.keys) == 0 && !t.root.isLeaf {
+		old := t.root
+		t.root = t.root.child(0)
+		t.alloc.FreeNode(old)
+	}
+}
+
+// ExplainDelete describes, without changing the tree, what Delete(key) would
+// do: the rebalancing at each level on the way down, the leaf losing the key
+// and whether the tree would lose a level. It works on copies of the nodes
+// along the path so the description follows the real algorithm exactly.
+func (t *BPlusTree[K, V]) ExplainDelete(key K) string {
+	key = t.norm(key)
+	if _, found := t.Search(key); !found {
+		return fmt.Sprintf("Key '%v' is not in the tree; delete would change nothing.", key)
+	}
+
+	var lines []string
+	heap := heapAllocator[K, V]{} // Scratch copies are left to the GC, not a custom allocator
+	root := cloneNode[K, V](heap, t.root)
+	height := t.Height()
+	n, depth := root, 0
+	for !n.isLeaf {
+		idx := n.childIndex(key, t.less)
+		// Copy everything fill may touch: the child and both its siblings
+		for j := idx - 1; j <= idx+1; j++ {
+			if j >= 0 && j < len(n.children) {
+				n.children[j] = cloneNode[K, V](heap, n.child(j))
+			}
+		}
+		child := n.child(idx)
+		kind := "node"
+		if child.isLeaf {
+			kind = "leaf"
+		}
+		if len(child.keys) > t.order-2 {
+			lines = append(lines, fmt.Sprintf("Depth %d: %s %d has %d keys, above the minimum of %d; no rebalancing.", depth+1, kind, idx, len(child.keys), t.order-2))
+		} else {
+			last := len(n.children) - 1
+			var action string
+			switch {
+			case idx != 0 && len(n.child(idx-1).keys) > t.order-2:
+				action = fmt.Sprintf("borrows a key from its left sibling (%d keys)", len(n.child(idx-1).keys))
+			case idx != last && len(n.child(idx+1).keys) > t.order-2:
+				action = fmt.Sprintf("borrows a key from its right sibling (%d keys)", len(n.child(idx+1).keys))
+			case idx != last:
+				action = fmt.Sprintf("merges with its right sibling (%d keys)", len(n.child(idx+1).keys))
+			default:
+				action = fmt.Sprintf("merges with its left sibling (%d keys)", len(n.child(idx-1).keys))
+			}
+			lines = append(lines, fmt.Sprintf("Depth %d: %s %d has only %d keys, so it %s before the delete descends.", depth+1, kind, idx, len(child.keys), action))
+			n.fill(idx, t.order, t.less, heap, nil)
+			idx = n.childIndex(key, t.less)
+		}
+		n = n.child(idx)
+		depth++
+	}
+	lines = append(lines, fmt.Sprintf("Key '%v' is removed from the leaf at depth %d, %v, leaving %d keys.", key, depth, n.keys, len(n.keys)-1))
+
+	if len(root.keys) == 0 && !root.isLeaf {
+		lines = append(lines, fmt.Sprintf("The root is left without keys and is replaced by its only child: height %d -> %d.", height, height-1))
+	} else {
+		lines = append(lines, fmt.Sprintf("Height stays at %d.", height))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// BatchDelete removes every listed key and returns how many were present.
+func (t *BPlusTree[K, V]) BatchDelete(keys []K) int {
+	t.mustWritable("delete")
+	deleted := 0
+	for _, key := range keys {
+		if _, found := t.Search(key); found {
+			t.Delete(key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// DeleteWhere removes every pair in [start, end] for which pred holds and
+// returns how many were removed. Matches are collected first and deleted after
+// the scan, so the leaf chain is never modified while it is being walked.
+func (t *BPlusTree[K, V]) DeleteWhere(start K, end K, pred func(k K, v V) bool) int {
+	t.mustWritable("delete")
+	var doomed []K
+	t.ascendRange(start, end, func(k K, v V) bool {
+		if pred(k, v) {
+			doomed = append(doomed, k)
+		}
+		return true
+	})
+	for _, key := range doomed {
+		t.Delete(key)
+	}
+	return len(doomed)
+}
+
+func (n *BPlusTreeNode[K, V]) deleteKey(key K, order int, less func(K, K) bool, equal func(K, K) bool, alloc Allocator[K, V], obs *observer) {
+	if n.isLeaf {
+		idx := n.findKey(key, less)
+		if idx < len(n.keys) && equal(n.keys[idx], key) {
+			n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
+			n.values = append(n.values[:idx], n.values[idx+1:]...)
+			// Clear the vacated slot so the backing array doesn't pin the old value
+			n.keys[:len(n.keys)+1][len(n.keys)] = *new(K)
+			n.values[:len(n.values)+1][len(n.values)] = *new(V)
+		}
+		return
+	}
+
+	// Top up the child before descending so removing a key can't leave it
+	// below the minimum. Separators stay as they are; a stale one still
+	// divides its subtrees correctly.
+	idx := n.childIndex(key, less)
+	if len(n.child(idx).keys) <= order-2 {
+		n.fill(idx, order, less, alloc, obs)
+		idx = n.childIndex(key, less) // A merge may have shifted the children
+	}
+	n.child(idx).deleteKey(key, order, less, equal, alloc, obs)
+}
+
+func (n *BPlusTreeNode[K, V]) findKey(key K, less func(K, K) bool) int {
+	idx := 0
+	for idx < len(n.keys) && less(n.keys[idx], key) {
+		idx++
+	}
+	return idx
+}
+
+// childIndex returns which child of an internal node covers key: the number of
+// separators not greater than it.
+func (n *BPlusTreeNode[K, V]) childIndex(key K, less func(K, K) bool) int {
+	idx := 0
+	for idx < len(n.keys) && !less(key, n.keys[idx]) {
+		idx++
+	}
+	return idx
+}
+
+func (n *BPlusTreeNode[K, V]) fill(idx int, order int, less func(K, K) bool, alloc Allocator[K, V], obs *observer) {
+	if idx != 0 && len(n.child(idx-1).keys) > order-2 {
+		n.borrowFromPrev(idx)
+		obs.borrow(n.child(idx).isLeaf, "left")
+	} else if idx != len(n.children)-1 && len(n.child(idx+1).keys) > order-2 {
+		n.borrowFromNext(idx)
+		obs.borrow(n.child(idx).isLeaf, "right")
+	} else {
+		if idx != len(n.children)-1 {
+			n.merge(idx, order, alloc, obs)
+		} else {
+			n.merge(idx-1, order, alloc, obs)
+		}
+	}
+}
+
+func (n *BPlusTreeNode[K, V]) borrowFromPrev(idx int) {
+	child := n.child(idx)
+	sibling := n.child(idx - 1)
+	last := len(sibling.keys) - 1
+
+	if child.isLeaf {
+		// Move the sibling's largest pair over; it becomes the new separator
+		child.keys = append([]K{sibling.keys[last]}, child.keys...)
+		child.values = append([]V{sibling.values[last]}, child.values...)
+		sibling.keys = sibling.keys[:last]
+		sibling.values = sibling.values[:last]
+		n.keys[idx-1] = child.keys[0]
+		return
+	}
+
+	// Rotate through the parent: its separator comes down, the sibling's last key goes up
+	child.keys = append([]K{n.keys[idx-1]}, child.keys...)
+	child.children = append([]*BPlusTreeNode[K, V]{sibling.children[len(sibling.children)-1]}, child.children...)
+	n.keys[idx-1] = sibling.keys[last]
+	sibling.keys = sibling.keys[:last]
+	sibling.children = sibling.children[:len(sibling.children)-1]
+}
+
+func (n *BPlusTreeNode[K, V]) borrowFromNext(idx int) {
+	child := n.child(idx)
+	sibling := n.child(idx + 1)
+
+	if child.isLeaf {
+		child.keys = append(child.keys, sibling.keys[0])
+		child.values = append(child.values, sibling.values[0])
+		sibling.keys = sibling.keys[1:]
+		sibling.values = sibling.values[1:]
+		n.keys[idx] = sibling.keys[0]
+		return
+	}
+
+	child.keys = append(child.keys, n.keys[idx])
+	child.children = append(child.children, sibling.children[0])
+	n.keys[idx] = sibling.keys[0]
+	sibling.keys = sibling.keys[1:]
+	sibling.children = sibling.children[1:]
+}
+
+// merge folds children[idx+1] into children[idx] and drops their separator.
+func (n *BPlusTreeNode[K, V]) merge(idx int, order int, alloc Allocator[K, V], obs *observer) {
+	child := n.child(idx)
+	sibling := n.child(idx + 1)
+
+	if child.isLeaf {
+		child.keys = append(child.keys, sibling.keys...)
+		child.values = append(child.values, sibling.values...)
+		child.next = sibling.next
+	} else {
+		// Internal nodes pull the separator down between the two halves
+		child.keys = append(child.keys, n.keys[idx])
+		child.keys = append(child.keys, sibling.keys...)
+		child.children = append(child.children, sibling.children...)
+	}
+
+	n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
+	n.children = append(n.children[:idx+1], n.children[idx+2:]...)
+	alloc.FreeNode(sibling)
+	obs.merge(child.isLeaf, len(child.keys))
+}
+
+// compactChild merges children[idx] with its right or left neighbour if the
+// two fit in one node, and returns the index of the child now covering idx.
+func (n *BPlusTreeNode[K, V]) compactChild(idx int, maxKeys int, order int, alloc Allocator[K, V], obs *observer) int {
+	fits := func(a, b *BPlusTreeNode[K, V]) bool {
+		size := len(a.keys) + len(b.keys)
+		if !a.isLeaf {
+			size++ // The separator comes down into a merged internal node
+		}
+		return size <= maxKeys
+	}
+	if idx+1 < len(n.children) && fits(n.child(idx), n.child(idx+1)) {
+		n.merge(idx, order, alloc, obs)
+	} else if idx > 0 && fits(n.child(idx-1), n.child(idx)) {
+		n.merge(idx-1, order, alloc, obs)
+		idx--
+	}
+	return idx
+}
+
+// GET
+func (t *BPlusTree[K, V]) Get(key K) (V, bool) {
+	key = t.norm(key)
+	value, found := t.Search(key)
+	if found {
+		t.read(key)
+	}
+	return value, found
+}
+
+// read does the bookkeeping for a hit on key by Get or GetOrInsert.
+func (t *BPlusTree[K, V]) read(key K) {
+	if t.maxEntries > 0 {
+		t.touch(key) // A read counts as a use for LRU eviction
+	}
+	if t.access != nil {
+		t.access[key]++
+	}
+}
+
+// Clear resets the B+ Tree to an empty state. The only error is ErrFrozen.
+func (t *BPlusTree[K, V]) Clear() error {
+	if err := t.writable("clear"); err != nil {
+		return err
+	}
+	var removed []Pair[K, V]
+	if len(t.hooks.delete) > 0 {
+		removed = t.pairs()
+	}
+	t.clear(removed)
+	return nil
+}
+
+// Drain empties the tree and returns everything it held in key order, like
+// collecting every pair and then calling Clear but with a single walk of the
+// leaves. The tree is immediately ready for new writes.
+func (t *BPlusTree[K, V]) Drain() []Pair[K, V] {
+	t.mustWritable("drain")
+	pairs := t.pairs()
+	t.clear(pairs)
+	return pairs
+}
+
+// pairs returns every pair in key order.
+func (t *BPlusTree[K, V]) pairs() []Pair[K, V] {
+	var pairs []Pair[K, V]
+	t.ascend(func(k K, v V) bool {
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
+
+// clear does the work of Clear once the removed pairs, needed only for
+// OnDelete hooks, have been collected.
+func (t *BPlusTree[K, V]) clear(removed []Pair[K, V]) {
+	if t.root != nil && !t.cow {
+		freeAll(t.alloc, t.root)
+	}
+	t.root = newBPlusTreeNode(t.alloc, t.order) // Fresh empty leaf, as in NewBPlusTree
+	t.cow = false
+	t.modCount++
+	if t.maxEntries > 0 {
+		t.lru.Init()
+		t.lruIndex = make(map[K]*list.Element)
+	}
+	if t.versions != nil {
+		t.versions = make(map[K]uint64)
+	}
+	if t.meta != nil {
+		t.meta = make(map[K]EntryMeta)
+	}
+	if t.access != nil {
+		t.access = make(map[K]int)
+	}
+	if t.arrival != nil {
+		t.arrival = make(map[K]uint64)
+	}
+	if t.bloom != nil {
+		t.bloom.reset()
+	}
+	for _, p := range removed {
+		t.hooks.fireDelete(p.Key, p.Value)
+	}
+}
+
+// SetMaxEntries bounds the tree to n keys, evicting the least recently used
+// key whenever an insert pushes the count past n. n <= 0 removes the bound.
+func (t *BPlusTree[K, V]) SetMaxEntries(n int) {
+	t.mustWritable("set max entries")
+	if n <= 0 {
+		t.maxEntries = 0
+		t.lru = nil
+		t.lruIndex = nil
+		return
+	}
+	if t.maxEntries == 0 {
+		// Seed recency with the existing keys; in key order, as we have no history
+		t.lru = list.New()
+		t.lruIndex = make(map[K]*list.Element)
+		for _, key := range t.List() {
+			t.touch(key)
+		}
+	}
+	t.maxEntries = n
+	t.evict()
+}
+
+// MaxEntries returns the configured bound, or 0 if the tree is unbounded.
+func (t *BPlusTree[K, V]) MaxEntries() int {
+	return t.maxEntries
+}
+
+// touch marks key as the most recently used.
+func (t *BPlusTree[K, V]) touch(key K) {
+	if elem, ok := t.lruIndex[key]; ok {
+		t.lru.MoveToFront(elem)
+		return
+	}
+	t.lruIndex[key] = t.lru.PushFront(key)
+}
+
+// forget drops key from the recency list after it leaves the tree.
+func (t *BPlusTree[K, V]) forget(key K) {
+	if t.maxEntries == 0 {
+		return
+	}
+	if elem, ok := t.lruIndex[key]; ok {
+		t.lru.Remove(elem)
+		delete(t.lruIndex, key)
+	}
+}
+
+// evict removes least recently used keys until the bound is respected.
+func (t *BPlusTree[K, V]) evict() {
+	for t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back().Value.(K)
+		if _, removed := t.remove(oldest); !removed {
+			return
+		}
+	}
+}
+
+// EnableVersioning starts stamping every write with a version from a
+// tree-wide counter, so a key's version grows on each Insert or Update of it
+// and is never reused, even after the key is deleted and inserted again.
+// Entries written before versioning was enabled report version 0.
+func (t *BPlusTree[K, V]) EnableVersioning() {
+	if t.versions == nil {
+		t.versions = make(map[K]uint64)
+	}
+}
+
+// GetVersioned returns the value for key along with the version of the write
+// that stored it.
+func (t *BPlusTree[K, V]) GetVersioned(key K) (V, uint64, bool) {
+	value, found := t.Get(key)
+	if !found {
+		return value, 0, false
+	}
+	return value, t.versions[key], true
+}
+
+// recordWrite stamps a write of key with the next version and the current
+// time, for whichever of versioning and timestamps are enabled. created is
+// true when the write added the key.
+func (t *BPlusTree[K, V]) recordWrite(key K, created bool) {
+	if t.versions != nil {
+		t.writeSeq++
+		t.versions[key] = t.writeSeq
+	}
+	if t.meta != nil {
+		now := time.Now()
+		m := t.meta[key]
+		if created {
+			m.CreatedAt = now
+		}
+		m.UpdatedAt = now
+		t.meta[key] = m
+	}
+	if created && t.arrival != nil {
+		t.arrivalSeq++
+		t.arrival[key] = t.arrivalSeq
+	}
+}
+
+// AccessCount returns how many times Get has found key since it was
+// inserted. It is always 0 unless the tree was created with
+// WithAccessTracking.
+func (t *BPlusTree[K, V]) AccessCount(key K) int {
+	return t.access[t.norm(key)]
+}
+
+// LeastAccessed returns the n keys with the fewest Get hits, coldest first
+// and in key order among equal counts, as candidates for LFU eviction. Every
+// key is considered, so this is a full scan.
+func (t *BPlusTree[K, V]) LeastAccessed(n int) []K {
+	if n <= 0 {
+		return nil
+	}
+	keys := t.List()
+	sort.SliceStable(keys, func(i, j int) bool { return t.access[keys[i]] < t.access[keys[j]] })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// InInsertionOrder returns every pair ordered by when its key was inserted,
+// oldest first, as an append log view of the tree; updates keep a key's
+// place, while a key deleted and inserted again moves to the end. Pairs
+// stored by ReplaceAll or LoadSortedFile count as inserted in key order. It
+// is only available on trees created with WithInsertionOrder, and returns
+// nil otherwise. Every pair is collected and sorted, so this is O(n log n).
+func (t *BPlusTree[K, V]) InInsertionOrder() []Pair[K, V] {
+	if t.arrival == nil {
+		return nil
+	}
+	pairs := t.pairs()
+	sort.Slice(pairs, func(i, j int) bool { return t.arrival[pairs[i].Key] < t.arrival[pairs[j].Key] })
+	return pairs
+}
+
+// EntryMeta records when an entry was first inserted and last written.
+type EntryMeta struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// GetMeta returns the timestamps of key. It is only available on trees
+// created with WithTimestamps.
+func (t *BPlusTree[K, V]) GetMeta(key K) (EntryMeta, bool) {
+	m, ok := t.meta[t.norm(key)]
+	return m, ok
+}
+
+// TrimCapacity reallocates every node's key, value and child slices to their
+// exact length. Slices grow by append and are only resliced on delete, so
+// after heavy deletion their backing arrays can be far larger than the data.
+func (t *BPlusTree[K, V]) TrimCapacity() {
+	t.own()
+	var trim func(n *BPlusTreeNode[K, V])
+	trim = func(n *BPlusTreeNode[K, V]) {
+		if cap(n.keys) > len(n.keys) {
+			n.keys = append(make([]K, 0, len(n.keys)), n.keys...)
+		}
+		if cap(n.values) > len(n.values) {
+			n.values = append(make([]V, 0, len(n.values)), n.values...)
+		}
+		if cap(n.children) > len(n.children) {
+			n.children = append(make([]*BPlusTreeNode[K, V], 0, len(n.children)), n.children...)
+		}
+		for _, child := range n.children {
+			trim(child)
+		}
+	}
+	if t.root != nil {
+		trim(t.root)
+	}
+}
+
+// Order returns the order the tree was created with.
+func (t *BPlusTree[K, V]) Order() int {
+	return t.order
+}
+
+// MaxKeysPerNode returns how many keys a node holds before it is split.
+func (t *BPlusTree[K, V]) MaxKeysPerNode() int {
+	return 2 * (t.order - 1)
+}
+
+// MinKeysPerNode returns the fewest keys a non-root node may hold. Splitting a
+// full internal node leaves order-2 keys on its right, so that is the floor
+// delete rebalancing maintains.
+func (t *BPlusTree[K, V]) MinKeysPerNode() int {
+	return t.order - 2
+}
+
+// RecommendOrder suggests an order for values of about sampleValueSize bytes:
+// the one whose full leaves come closest to a 4 KiB page, counting 16 bytes
+// per key, clamped to [8, 16]. BenchmarkInsert, BenchmarkGet and
+// BenchmarkRange compare orders for a given workload.
+func RecommendOrder(sampleValueSize int) int {
+	const (
+		pageBytes = 4096
+		keyBytes  = 16
+		lowest    = 8
+		highest   = 16
+	)
+	slots := pageBytes / (max(sampleValueSize, 0) + keyBytes)
+	return min(max(slots/2+1, lowest), highest)
+}
+
+func (t *BPlusTree[K, V]) Height() int {
+	return t.height(t.root)
+}
+
+// Helper method to calculate the height of the tree recursively
+func (t *BPlusTree[K, V]) height(node *BPlusTreeNode[K, V]) int {
+	if node == nil {
+		return 0
+	}
+	if node.isLeaf {
+		return 1
+	}
+	return 1 + t.height(node.child(0)) // Height is the height of the first child + 1
+}
+
+// Update
+func (t *BPlusTree[K, V]) Update(key K, value V) error {
+	key = t.norm(key)
+	if err := t.admit("update", key); err != nil {
+		return err
+	}
+	if !t.Replace(key, value) {
+		return fmt.Errorf("update '%v': %w", key, ErrKeyNotFound)
+	}
+	return nil
+}
+
+// Replace overwrites the value of key in place and reports whether key was
+// present; an absent key is left absent. It is Update for callers to whom a
+// missing key isn't an error.
+func (t *BPlusTree[K, V]) Replace(key K, value V) bool {
+	key = t.norm(key)
+	node, idx := t.locate(key)
+	if node == nil {
+		return false
+	}
+	t.mustWritable("replace")
+	if t.cow {
+		// The leaf found may be shared; find the key again in t's own copy
+		t.own()
+		node, idx = t.locate(key)
+	}
+	t.replace(node, idx, value)
+	return true
+}
+
+// Exists checks if the given key exists in the B+ Tree.
+func (t *BPlusTree[K, V]) Exists(key K) bool {
+	_, found := t.Search(key) // Search rather than Get so a probe doesn't refresh recency
+	return found
+}
+
+func (t *BPlusTree[K, V]) Count() int {
+	return t.count(t.root)
+}
+
+// Helper method to count keys recursively
+func (t *BPlusTree[K, V]) count(node *BPlusTreeNode[K, V]) int {
+	if node == nil {
+		return 0
+	}
+	if node.isLeaf {
+		return len(node.keys)
+	}
+	count := 0
+	for i := range node.children {
+		count += t.count(node.child(i))
+	}
+	return count
+}
+
+// List retrieves all keys from the B+ Tree.
+func (t *BPlusTree[K, V]) List() []K {
+	var keys []K
+	// Leaves hold every key; internal keys are separators and would repeat them
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		keys = append(keys, current.keys...)
+	}
+	return keys
+}
+
+// ToMap copies every pair into a map.
+func (t *BPlusTree[K, V]) ToMap() map[K]V {
+	m := make(map[K]V, t.Count())
+	t.ascend(func(k K, v V) bool {
+		m[k] = v
+		return true
+	})
+	return m
+}
+
+// Range retrieves all key-value pairs within a given range.
+func (t *BPlusTree[K, V]) Range(start K, end K) map[K]V {
+	start, end = t.norm(start), t.norm(end)
+	result := make(map[K]V)
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		for i := 0; i < len(current.keys); i++ {
+			if t.less(start, current.keys[i]) && t.less(current.keys[i], end) {
+				result[current.keys[i]] = current.values[i]
+			}
+		}
+	}
+	return result
+}
+
+// leftmostLeaf returns the first leaf in the chain, or nil for a nil root.
+func (t *BPlusTree[K, V]) leftmostLeaf() *BPlusTreeNode[K, V] {
+	current := t.root
+	for current != nil && !current.isLeaf {
+		current = current.child(0)
+	}
+	return current
+}
+
+// rightmostLeaf returns the last leaf in the chain, or nil for a nil root.
+func (t *BPlusTree[K, V]) rightmostLeaf() *BPlusTreeNode[K, V] {
+	current := t.root
+	for current != nil && !current.isLeaf {
+		current = current.child(len(current.children) - 1)
+	}
+	return current
+}
+
+// prevLeaf returns the leaf before n in key order. Leaves only link forward,
+// so the predecessor is found from the root via n's first key.
+func (t *BPlusTree[K, V]) prevLeaf(n *BPlusTreeNode[K, V]) *BPlusTreeNode[K, V] {
+	if len(n.keys) == 0 {
+		return nil // Only an empty root leaf has no keys
+	}
+	first := n.keys[0]
+	var predecessor *BPlusTreeNode[K, V]
+	for current := t.root; !current.isLeaf; {
+		i := current.childIndex(first, t.less)
+		if i > 0 {
+			predecessor = current.child(i - 1)
+		}
+		current = current.child(i)
+	}
+	for predecessor != nil && !predecessor.isLeaf {
+		predecessor = predecessor.child(len(predecessor.children) - 1)
+	}
+	return predecessor
+}
+
+// descend calls fn for every pair in descending key order until fn returns false.
+func (t *BPlusTree[K, V]) descend(fn func(K, V) bool) {
+	for current := t.rightmostLeaf(); current != nil; current = t.prevLeaf(current) {
+		for i := len(current.keys) - 1; i >= 0; i-- {
+			if !fn(current.keys[i], current.values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Min returns the smallest key and its value, or ErrEmptyTree.
+func (t *BPlusTree[K, V]) Min() (K, V, error) {
+	leaf := t.leftmostLeaf()
+	if leaf == nil || len(leaf.keys) == 0 {
+		return *new(K), *new(V), ErrEmptyTree
+	}
+	return leaf.keys[0], leaf.values[0], nil
+}
+
+// Max returns the largest key and its value, or ErrEmptyTree.
+func (t *BPlusTree[K, V]) Max() (K, V, error) {
+	leaf := t.rightmostLeaf()
+	if leaf == nil || len(leaf.keys) == 0 {
+		return *new(K), *new(V), ErrEmptyTree
+	}
+	last := len(leaf.keys) - 1
+	return leaf.keys[last], leaf.values[last], nil
+}
+
+// KeyRange returns the smallest and largest keys, e.g. to clamp the bounds of
+// a range scan, and false for an empty tree. It costs what Min and Max do
+// together, one descent down each edge of the tree.
+func (t *BPlusTree[K, V]) KeyRange() (lo, hi K, ok bool) {
+	first, last := t.leftmostLeaf(), t.rightmostLeaf()
+	if first == nil || len(first.keys) == 0 || len(last.keys) == 0 {
+		return lo, hi, false
+	}
+	return first.keys[0], last.keys[len(last.keys)-1], true
+}
+
+// seek descends to the leaf where key belongs and returns it along with the
+// index of the first key in that leaf that is not less than key.
+func (t *BPlusTree[K, V]) seek(key K) (*BPlusTreeNode[K, V], int) {
+	current := t.root
+	for !current.isLeaf {
+		current = current.child(current.findKey(key, t.less))
+	}
+	return current, current.findKey(key, t.less)
+}
+
+// Closest returns the pair whose key is nearest to key under dist: key itself
+// if present, otherwise the nearer of its floor (largest smaller key) and
+// ceiling (smallest larger key), preferring the ceiling on a tie. It reports
+// false only for an empty tree.
+func (t *BPlusTree[K, V]) Closest(key K, dist func(a, b K) float64) (K, V, bool) {
+	key = t.norm(key)
+	if t.root == nil {
+		return *new(K), *new(V), false
+	}
+	leaf, i := t.seek(key)
+
+	ceil, ci := leaf, i
+	if ci == len(ceil.keys) {
+		ceil, ci = t.nextLeaf(leaf), 0
+	}
+	if ceil != nil && t.equal(ceil.keys[ci], key) {
+		return ceil.keys[ci], ceil.values[ci], true
+	}
+	floor, fi := leaf, i-1
+	if fi < 0 {
+		if floor = t.prevLeaf(leaf); floor != nil {
+			fi = len(floor.keys) - 1
+		}
+	}
+
+	switch {
+	case ceil == nil && floor == nil:
+		return *new(K), *new(V), false
+	case ceil == nil:
+		return floor.keys[fi], floor.values[fi], true
+	case floor == nil || dist(key, ceil.keys[ci]) <= dist(key, floor.keys[fi]):
+		return ceil.keys[ci], ceil.values[ci], true
+	default:
+		return floor.keys[fi], floor.values[fi], true
+	}
+}
+
+// ascendRange calls fn for every pair in [start, end] in key order, following
+// the leaf chain and stopping at the first key past end or when fn returns false.
+func (t *BPlusTree[K, V]) ascendRange(start K, end K, fn func(K, V) bool) {
+	start, end = t.norm(start), t.norm(end)
+	if t.root == nil {
+		return
+	}
+	current, i := t.seek(start)
+	for current != nil {
+		for ; i < len(current.keys); i++ {
+			if t.less(end, current.keys[i]) {
+				return
+			}
+			if !fn(current.keys[i], current.values[i]) {
+				return
+			}
+		}
+		current = t.nextLeaf(current)
+		i = 0
+	}
+}
+
+// ascend calls fn for every pair in key order until fn returns false.
+func (t *BPlusTree[K, V]) ascend(fn func(K, V) bool) {
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		for i := 0; i < len(current.keys); i++ {
+			if !fn(current.keys[i], current.values[i]) {
+				return
+			}
+		}
+	}
+}
+
+// FindByValue returns, in key order, every key whose value matches v.
+// This is a full scan of the leaf chain.
+func (t *BPlusTree[K, V]) FindByValue(v V, equal func(V, V) bool) []K {
+	var keys []K
+	t.ascend(func(k K, value V) bool {
+		if equal(value, v) {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys
+}
+
+// FindFirstByValue returns the smallest key whose value matches v, stopping
+// the scan as soon as it is found.
+func (t *BPlusTree[K, V]) FindFirstByValue(v V, equal func(V, V) bool) (K, bool) {
+	var key K
+	found := false
+	t.ascend(func(k K, value V) bool {
+		if equal(value, v) {
+			key, found = k, true
+			return false
+		}
+		return true
+	})
+	return key, found
+}
+
+// RangeContext is Range with cancellation: ctx is checked at every leaf and
+// its error is returned if the scan is abandoned. Unlike Range it stops at end
+// instead of walking the rest of the leaf chain.
+func (t *BPlusTree[K, V]) RangeContext(ctx context.Context, start K, end K) (map[K]V, error) {
+	start, end = t.norm(start), t.norm(end)
+	result := make(map[K]V)
+	if t.root == nil {
+		return result, nil
+	}
+	current, i := t.seek(start)
+	for current != nil {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for ; i < len(current.keys); i++ {
+			if !t.less(current.keys[i], end) {
+				return result, nil
+			}
+			if t.less(start, current.keys[i]) {
+				result[current.keys[i]] = current.values[i]
+			}
+		}
+		current = t.nextLeaf(current)
+		i = 0
+	}
+	return result, nil
+}
+
+// ForEachContext calls fn for every pair in key order until fn returns false,
+// checking ctx at every leaf and returning its error if it is cancelled.
+func (t *BPlusTree[K, V]) ForEachContext(ctx context.Context, fn func(K, V) bool) error {
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for i := 0; i < len(current.keys); i++ {
+			if !fn(current.keys[i], current.values[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// FirstN returns the n smallest pairs in ascending order, or all of them if
+// the tree holds fewer.
+func (t *BPlusTree[K, V]) FirstN(n int) []Pair[K, V] {
+	var pairs []Pair[K, V]
+	if n <= 0 {
+		return pairs
+	}
+	t.ascend(func(k K, v V) bool {
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return len(pairs) < n
+	})
+	return pairs
+}
+
+// LastN returns the n largest pairs in ascending order, or all of them if the
+// tree holds fewer. Only the leaves holding them are visited.
+func (t *BPlusTree[K, V]) LastN(n int) []Pair[K, V] {
+	var pairs []Pair[K, V]
+	if n <= 0 {
+		return pairs
+	}
+	t.descend(func(k K, v V) bool {
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return len(pairs) < n
+	})
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return pairs
+}
+
+// Quantile returns the key at fraction q of the way through the tree in key
+// order: 0 is the smallest key, 1 the largest and 0.5 the median (the lower
+// one for an even count). It reports false for an empty tree or q outside
+// [0, 1]. Leaves before the target are skipped by size without reading keys.
+func (t *BPlusTree[K, V]) Quantile(q float64) (K, bool) {
+	var zero K
+	n := t.Count()
+	if n == 0 || q < 0 || q > 1 {
+		return zero, false
+	}
+	keys := t.keysAt([]int{int(q * float64(n-1))})
+	return keys[0], true
+}
+
+// ApproxQuantiles returns n keys at evenly spaced positions, splitting the
+// tree into n+1 runs of roughly equal size; they are natural split points
+// for sharding. All positions are found in one pass over the leaf chain, so
+// this is cheaper than n calls to Quantile. Fewer keys than n are returned
+// only if the tree holds fewer than n.
+func (t *BPlusTree[K, V]) ApproxQuantiles(n int) []K {
+	count := t.Count()
+	if n <= 0 || count == 0 {
+		return nil
+	}
+	if n > count {
+		n = count
+	}
+	positions := make([]int, n)
+	for i := range positions {
+		positions[i] = (i + 1) * count / (n + 1)
+	}
+	return t.keysAt(positions)
+}
+
+// keysAt returns the keys at the given ascending zero-based positions.
+func (t *BPlusTree[K, V]) keysAt(positions []int) []K {
+	keys := make([]K, 0, len(positions))
+	seen := 0 // Keys in the leaves before leaf
+	for leaf := t.leftmostLeaf(); leaf != nil && len(keys) < len(positions); leaf = t.nextLeaf(leaf) {
+		for len(keys) < len(positions) && positions[len(keys)] < seen+len(leaf.keys) {
+			keys = append(keys, leaf.keys[positions[len(keys)]-seen])
+		}
+		seen += len(leaf.keys)
+	}
+	return keys
+}
+
+// RangeKeys returns the keys in [start, end] in ascending order.
+func (t *BPlusTree[K, V]) RangeKeys(start K, end K) []K {
+	var keys []K
+	t.ascendRange(start, end, func(k K, _ V) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// RangeColumns returns the pairs in [start, end] in ascending order as two
+// parallel slices, keys[i] going with values[i]. Each column is contiguous,
+// which suits processing one of them at a time better than []Pair, and
+// there is no map to build as with Range.
+func (t *BPlusTree[K, V]) RangeColumns(start K, end K) (keys []K, values []V) {
+	t.ascendRange(start, end, func(k K, v V) bool {
+		keys = append(keys, k)
+		values = append(values, v)
+		return true
+	})
+	return keys, values
+}
 
-	if !y.isLeaf {
-		z.children = append(z.children, y.children[order:]...)
-		y.children = y.children[:order]
-	}
-	n.children = append(n.children[:i+1], append([]*BPlusTreeNode[K, V]{z}, n.children[i+1:]...)...)
-	n.keys = append(n.keys[:i], append([]K{y.keys[order-1]}, n.keys[i:]...)...)
+// RangeLimited returns the pairs in [start, end] in ascending order, but at
+// most maxScan of them; truncated reports that the range held more. Telling
+// that apart from a range of exactly maxScan pairs takes one more step of the
+// scan, so up to maxScan+1 entries are examined. To read the rest, call again
+// with start just past the last key returned, or page through with ScanFrom.
+func (t *BPlusTree[K, V]) RangeLimited(start K, end K, maxScan int) (pairs []Pair[K, V], truncated bool) {
+	t.ascendRange(start, end, func(k K, v V) bool {
+		if len(pairs) >= maxScan {
+			truncated = true
+			return false
+		}
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs, truncated
 }
 
-// Search function to check if a key already exists
-func (t *BPlusTree[K, V]) Search(key K) (V, bool) {
-	current := t.root
-	for current != nil {
-		idx := 0
-		// Find the index where the key could be
-		for idx < len(current.keys) && t.less(current.keys[idx], key) {
-			idx++
+// RangeBounds returns the pairs between start and end in ascending order,
+// with each bound included or excluded as its flag says; RangeBounds(a,
+// true, b, false) is the half-open [a, b). An empty result comes back for
+// bounds that cross, or that meet at a key one of them excludes.
+func (t *BPlusTree[K, V]) RangeBounds(start K, startInclusive bool, end K, endInclusive bool) []Pair[K, V] {
+	start, end = t.norm(start), t.norm(end)
+	var pairs []Pair[K, V]
+	t.ascendFrom(start, func(k K, v V) bool {
+		if !startInclusive && t.equal(k, start) {
+			return true
+		}
+		if t.less(end, k) || (!endInclusive && t.equal(k, end)) {
+			return false
 		}
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
 
-		// If the key matches, return the value
-		if idx < len(current.keys) && t.equal(current.keys[idx], key) {
-			return current.values[idx], true
+// RangeFrom returns the pairs with keys not less than start, in ascending
+// order, with no need for a sentinel key standing in for the maximum.
+func (t *BPlusTree[K, V]) RangeFrom(start K) []Pair[K, V] {
+	var pairs []Pair[K, V]
+	t.ascendFrom(start, func(k K, v V) bool {
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
 
+// RangeTo returns the pairs with keys not greater than end, in ascending
+// order from the smallest key.
+func (t *BPlusTree[K, V]) RangeTo(end K) []Pair[K, V] {
+	end = t.norm(end)
+	var pairs []Pair[K, V]
+	t.ascend(func(k K, v V) bool {
+		if t.less(end, k) {
+			return false
 		}
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
+
+// RangePartial returns, in key order, the pairs whose keys share a leading
+// part with partial, for composite keys ordered field by field: all entries
+// with A == x whatever their B. partial is the smallest key of that group,
+// its remaining fields at their minimum, and successor returns the smallest
+// key past the group, so the pairs returned are those in
+// [partial, successor(partial)). For keys struct{ A string; B int }:
+//
+//	lo := Key{A: x, B: math.MinInt}
+//	pairs := t.RangePartial(lo, func(k Key) Key {
+//		return Key{A: k.A + "\x00", B: math.MinInt} // Next A value up
+//	})
+func (t *BPlusTree[K, V]) RangePartial(partial K, successor func(K) K) []Pair[K, V] {
+	partial = t.norm(partial)
+	return t.RangeBounds(partial, true, successor(partial), false)
+}
+
+// CountRange returns the exact number of keys in [start, end], walking them.
+func (t *BPlusTree[K, V]) CountRange(start K, end K) int {
+	count := 0
+	t.ascendRange(start, end, func(K, V) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// EstimateRangeCount estimates the number of keys in [start, end] in
+// O(log n), for deciding whether a range is worth scanning before paying for
+// CountRange. Nodes don't keep counts of the keys below them, so each
+// subtree is assumed to be as full as the ones on the path to start. The
+// estimate is exact when both ends fall in one leaf. Otherwise, since a
+// non-root node may hold anywhere from MinKeysPerNode to MaxKeysPerNode
+// keys, it can be off in either direction by up to a factor of
+// MaxKeysPerNode/MinKeysPerNode for the leaves times (2*order-1)/(order-1)
+// for each internal level between them and the root: 3 * (7/3)^2, about 16,
+// for a 4-level tree of order 4. Trees that have shrunk through deletes sit
+// near the minimum fill and see the largest errors.
+func (t *BPlusTree[K, V]) EstimateRangeCount(start K, end K) int {
+	start, end = t.norm(start), t.norm(end)
+	if t.root == nil || t.less(end, start) {
+		return 0
+	}
 
-		// If we are at a leaf node, the key was not found
+	// sizes[d] estimates the keys under a node at depth d
+	var path []*BPlusTreeNode[K, V]
+	for current := t.root; ; current = current.child(current.childIndex(start, t.less)) {
+		path = append(path, current)
 		if current.isLeaf {
 			break
 		}
+	}
+	sizes := make([]int, len(path))
+	sizes[len(path)-1] = max(len(path[len(path)-1].keys), 1)
+	for d := len(path) - 2; d >= 0; d-- {
+		sizes[d] = len(path[d].children) * sizes[d+1]
+	}
 
-		// Move to the appropriate child node
-		current = current.children[idx]
+	// rank estimates how many keys sort before key, or also equal to it
+	rank := func(key K, inclusive bool) int {
+		r, depth := 0, 0
+		current := t.root
+		for !current.isLeaf {
+			idx := current.childIndex(key, t.less)
+			r += idx * sizes[depth+1]
+			current = current.child(idx)
+			depth++
+		}
+		idx := current.findKey(key, t.less)
+		if inclusive && idx < len(current.keys) && t.equal(current.keys[idx], key) {
+			idx++
+		}
+		return r + idx
 	}
-	return *new(V), false // Return false if the key is not found
+	return max(rank(end, true)-rank(start, false), 0)
 }
 
-// Modify Insert function to check for key uniqueness before insertion
-func (t *BPlusTree[K, V]) Insert(key K, value V) {
-	// Check if the key already exists
-	_, found := t.Search(key)
-	if found {
-		fmt.Printf("Key %v already exists. Insertion aborted.\n", key)
-		return
+// MultiRange returns, in key order, every pair falling in any of intervals.
+// Overlapping intervals are merged, so each pair appears once, and all of them
+// are answered in a single walk of the leaf chain from the lowest start.
+func (t *BPlusTree[K, V]) MultiRange(intervals []Interval[K]) []Pair[K, V] {
+	var merged []Interval[K]
+	sorted := make([]Interval[K], len(intervals))
+	for i, iv := range intervals {
+		sorted[i] = Interval[K]{Start: t.norm(iv.Start), End: t.norm(iv.End)}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return t.less(sorted[i].Start, sorted[j].Start) })
+	for _, iv := range sorted {
+		if t.less(iv.End, iv.Start) {
+			continue // Empty interval
+		}
+		if n := len(merged); n > 0 && !t.less(merged[n-1].End, iv.Start) {
+			if t.less(merged[n-1].End, iv.End) {
+				merged[n-1].End = iv.End
+			}
+			continue
+		}
+		merged = append(merged, iv)
 	}
 
-	// Proceed with normal insertion if key is unique
-	root := t.root
-	if len(root.keys) == 2*(t.order-1) {
-		newRoot := newBPlusTreeNode[K, V](t.order)
-		newRoot.isLeaf = false
-		newRoot.children = append(newRoot.children, root)
-		newRoot.splitChild(0, t.less)
-		newRoot.insertNonFull(key, value, t.less)
-		t.root = newRoot
-	} else {
-		root.insertNonFull(key, value, t.less)
+	var pairs []Pair[K, V]
+	if len(merged) == 0 {
+		return pairs
 	}
+	cur := 0
+	t.ascendFrom(merged[0].Start, func(k K, v V) bool {
+		for t.less(merged[cur].End, k) {
+			if cur++; cur == len(merged) {
+				return false
+			}
+		}
+		if !t.less(k, merged[cur].Start) {
+			pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		}
+		return true
+	})
+	return pairs
 }
 
-func (t *BPlusTree[K, V]) Traverse() {
+// ascendFrom calls fn for every pair with a key not less than start, in key
+// order, until fn returns false.
+func (t *BPlusTree[K, V]) ascendFrom(start K, fn func(K, V) bool) {
+	start = t.norm(start)
 	if t.root == nil {
-		fmt.Println("Tree is empty")
 		return
 	}
-
-	// Start at the leftmost leaf
-	current := t.root
-	for !current.isLeaf {
-		current = current.children[0]
-	}
-
-	// Table header
-	fmt.Println(strings.Repeat("-", 80))
-	fmt.Printf("%-6s | %-10s | %-10s\n", "Index", "Key", "Value")
-	fmt.Println(strings.Repeat("-", 80))
-
-	// Traverse through the linked list of leaf nodes
-	index := 0
+	current, i := t.seek(start)
 	for current != nil {
-		for i := 0; i < len(current.keys); i++ {
-			// Print in table format: Index, Key, Value
-			fmt.Printf("%-6d | %-10v | %-10v\n", index, current.keys[i], current.values[i])
-			fmt.Println(strings.Repeat(".", 80))
-			index++
+		for ; i < len(current.keys); i++ {
+			if !fn(current.keys[i], current.values[i]) {
+				return
+			}
 		}
-		current = current.next
+		current = t.nextLeaf(current)
+		i = 0
 	}
 }
 
-func (t *BPlusTree[K, V]) Delete(key K) {
-	t.root.deleteKey(key, t.order, t.less, t.equal)
-
-	if len(t.root.keys) == 0 {
-		if !t.root.isLeaf {
-			t.root = t.root.children[0]
-		} else {
-			t.root = nil
-		}
-	}
+// SetCursorCodec sets how ScanFrom turns keys into cursors and back.
+func (t *BPlusTree[K, V]) SetCursorCodec(encode func(K) []byte, decode func([]byte) (K, error)) {
+	t.encodeKey = encode
+	t.decodeKey = decode
 }
 
-func (n *BPlusTreeNode[K, V]) deleteKey(key K, order int, less func(K, K) bool, equal func(K, K) bool) {
-	idx := n.findKey(key, less)
+// ScanFrom returns up to limit pairs following the key encoded in cursor, or
+// from the smallest key if cursor is empty. next resumes the scan right after
+// the last returned key and is nil once there is nothing left. Because the
+// cursor names a key rather than an offset, pages stay consistent while the
+// tree changes between calls. A limit <= 0 returns everything remaining.
+func (t *BPlusTree[K, V]) ScanFrom(cursor []byte, limit int) (pairs []Pair[K, V], next []byte, err error) {
+	if t.encodeKey == nil || t.decodeKey == nil {
+		return nil, nil, fmt.Errorf("no cursor codec set; call SetCursorCodec first")
+	}
 
-	if idx < len(n.keys) && equal(n.keys[idx], key) {
-		if n.isLeaf {
-			n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
-			n.values = append(n.values[:idx], n.values[idx+1:]...)
-		} else {
-			n.deleteFromInternal(idx, order, less, equal)
-		}
-	} else {
-		if n.isLeaf {
-			return
-		}
-		flag := (idx == len(n.keys))
-		if len(n.children[idx].keys) < order {
-			n.fill(idx, order, less)
-		}
-		if flag && idx > len(n.keys) {
-			n.children[idx-1].deleteKey(key, order, less, equal)
-		} else {
-			n.children[idx].deleteKey(key, order, less, equal)
+	collect := func(k K, v V) bool {
+		if limit > 0 && len(pairs) == limit {
+			next = t.encodeKey(pairs[len(pairs)-1].Key) // Something remains past this page
+			return false
 		}
+		pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
+		return true
 	}
-}
 
-func (n *BPlusTreeNode[K, V]) findKey(key K, less func(K, K) bool) int {
-	idx := 0
-	for idx < len(n.keys) && less(n.keys[idx], key) {
-		idx++
+	if len(cursor) == 0 {
+		t.ascend(collect)
+		return pairs, next, nil
 	}
-	return idx
+	after, err := t.decodeKey(cursor)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cursor: %w", err)
+	}
+	t.ascendFrom(after, func(k K, v V) bool {
+		if t.equal(k, after) {
+			return true
+		}
+		return collect(k, v)
+	})
+	return pairs, next, nil
 }
 
-func (n *BPlusTreeNode[K, V]) deleteFromInternal(idx int, order int, less func(K, K) bool, equal func(K, K) bool) {
-	key := n.keys[idx]
-	if len(n.children[idx].keys) >= order {
-		pred := n.getPredecessor(idx)
-		n.keys[idx] = pred
-		n.children[idx].deleteKey(pred, order, less, equal)
-	} else if len(n.children[idx+1].keys) >= order {
-		succ := n.getSuccessor(idx)
-		n.keys[idx] = succ
-		n.children[idx+1].deleteKey(succ, order, less, equal)
-	} else {
-		n.merge(idx, order)
-		n.children[idx].deleteKey(key, order, less, equal)
-	}
+// SumRange adds up the numeric form of every value with a key in [start, end].
+func (t *BPlusTree[K, V]) SumRange(start K, end K, value func(V) float64) float64 {
+	sum := 0.0
+	t.ascendRange(start, end, func(_ K, v V) bool {
+		sum += value(v)
+		return true
+	})
+	return sum
 }
 
-func (n *BPlusTreeNode[K, V]) getPredecessor(idx int) K {
-	cur := n.children[idx]
-	for !cur.isLeaf {
-		cur = cur.children[len(cur.children)-1]
-	}
-	return cur.keys[len(cur.keys)-1]
+// MinValueRange returns the smallest numeric value with a key in [start, end].
+// The bool is false if the range holds no keys.
+func (t *BPlusTree[K, V]) MinValueRange(start K, end K, value func(V) float64) (float64, bool) {
+	min, found := 0.0, false
+	t.ascendRange(start, end, func(_ K, v V) bool {
+		if x := value(v); !found || x < min {
+			min, found = x, true
+		}
+		return true
+	})
+	return min, found
+}
+
+// MaxValueRange returns the largest numeric value with a key in [start, end].
+// The bool is false if the range holds no keys.
+func (t *BPlusTree[K, V]) MaxValueRange(start K, end K, value func(V) float64) (float64, bool) {
+	max, found := 0.0, false
+	t.ascendRange(start, end, func(_ K, v V) bool {
+		if x := value(v); !found || x > max {
+			max, found = x, true
+		}
+		return true
+	})
+	return max, found
 }
 
-func (n *BPlusTreeNode[K, V]) getSuccessor(idx int) K {
-	cur := n.children[idx+1]
-	for !cur.isLeaf {
-		cur = cur.children[0]
+// AvgRange returns the mean numeric value over keys in [start, end].
+// The bool is false if the range holds no keys.
+func (t *BPlusTree[K, V]) AvgRange(start K, end K, value func(V) float64) (float64, bool) {
+	sum, n := 0.0, 0
+	t.ascendRange(start, end, func(_ K, v V) bool {
+		sum += value(v)
+		n++
+		return true
+	})
+	if n == 0 {
+		return 0, false
 	}
-	return cur.keys[0]
+	return sum / float64(n), true
 }
 
-func (n *BPlusTreeNode[K, V]) fill(idx int, order int, less func(K, K) bool) {
-	if idx != 0 && len(n.children[idx-1].keys) >= order {
-		n.borrowFromPrev(idx)
-	} else if idx != len(n.children)-1 && len(n.children[idx+1].keys) >= order {
-		n.borrowFromNext(idx)
-	} else {
-		if idx != len(n.children)-1 {
-			n.merge(idx, order)
-		} else {
-			n.merge(idx-1, order)
+// FilterRange returns, in key order, the pairs in [start, end] for which pred
+// holds. The range is scanned once and the scan stops past end.
+func (t *BPlusTree[K, V]) FilterRange(start K, end K, pred func(k K, v V) bool) []Pair[K, V] {
+	var pairs []Pair[K, V]
+	t.ascendRange(start, end, func(k K, v V) bool {
+		if pred(k, v) {
+			pairs = append(pairs, Pair[K, V]{Key: k, Value: v})
 		}
-	}
+		return true
+	})
+	return pairs
 }
 
-func (n *BPlusTreeNode[K, V]) borrowFromPrev(idx int) {
-	child := n.children[idx]
-	sibling := n.children[idx-1]
+// ContentHash returns an FNV-1a hash of every pair in key order. It depends
+// only on the data, so trees with the same pairs hash equally however their
+// nodes are shaped. Keys and values are hashed in the encoding set with
+// WithContentEncoding, or by default: booleans, numbers and strings,
+// including types defined on them, by their bytes, so distinct values never
+// encode alike. Any other type falls back to its %v formatting, which can
+// print distinct values the same way and prints most pointers, such as
+// those to numbers or inside structs, as addresses, so two trees holding
+// equal data behind different pointers hash differently. Give such types an
+// encoding.
+func (t *BPlusTree[K, V]) ContentHash() uint64 {
+	h := fnv.New64a()
+	t.ascend(func(k K, v V) bool {
+		t.hashPair(h, k, v)
+		return true
+	})
+	return h.Sum64()
+}
 
-	child.keys = append([]K{n.keys[idx-1]}, child.keys...)
-	child.values = append([]V{n.values[idx-1]}, child.values...)
-	n.keys[idx-1] = sibling.keys[len(sibling.keys)-1]
-	n.values[idx-1] = sibling.values[len(sibling.keys)-1]
-	sibling.keys = sibling.keys[:len(sibling.keys)-1]
-	sibling.values = sibling.values[:len(sibling.values)-1]
+// RangeHash is ContentHash restricted to the pairs in [start, end], scanning
+// only those. Hashing matching chunks of the keyspace on two trees narrows a
+// divergence down to the chunks whose hashes differ.
+func (t *BPlusTree[K, V]) RangeHash(start K, end K) uint64 {
+	h := fnv.New64a()
+	t.ascendRange(start, end, func(k K, v V) bool {
+		t.hashPair(h, k, v)
+		return true
+	})
+	return h.Sum64()
+}
 
-	if !child.isLeaf {
-		child.children = append([]*BPlusTreeNode[K, V]{sibling.children[len(sibling.children)-1]}, child.children...)
-		sibling.children = sibling.children[:len(sibling.children)-1]
+// hashPair feeds one pair to h, length-prefixing each field so that
+// ("ab", "c") and ("a", "bc") encode differently.
+func (t *BPlusTree[K, V]) hashPair(h hash.Hash64, k K, v V) {
+	key, value := t.hashKey, t.hashValue
+	if key == nil {
+		key = func(k K) []byte { return canonicalBytes(k) }
+	}
+	if value == nil {
+		value = func(v V) []byte { return canonicalBytes(v) }
+	}
+	var size [8]byte
+	for _, field := range [][]byte{key(k), value(v)} {
+		binary.BigEndian.PutUint64(size[:], uint64(len(field)))
+		h.Write(size[:])
+		h.Write(field)
 	}
 }
 
-func (n *BPlusTreeNode[K, V]) borrowFromNext(idx int) {
-	child := n.children[idx]
-	sibling := n.children[idx+1]
-
-	child.keys = append(child.keys, n.keys[idx])
-	child.values = append(child.values, n.values[idx])
-	n.keys[idx] = sibling.keys[0]
-	n.values[idx] = sibling.values[0]
-	sibling.keys = sibling.keys[1:]
-	sibling.values = sibling.values[1:]
-
-	if !child.isLeaf {
-		child.children = append(child.children, sibling.children[0])
-		sibling.children = sibling.children[1:]
+// canonicalBytes is ContentHash's default encoding of x; see there.
+func canonicalBytes(x any) []byte {
+	rv := reflect.ValueOf(x)
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			return []byte{1}
+		}
+		return []byte{0}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.BigEndian.AppendUint64(nil, uint64(rv.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.BigEndian.AppendUint64(nil, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(rv.Float()))
+	case reflect.String:
+		return []byte(rv.String())
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Bytes()
+		}
 	}
+	return []byte(fmt.Sprint(x))
 }
 
-func (n *BPlusTreeNode[K, V]) merge(idx int, order int) {
-	child := n.children[idx]
-	sibling := n.children[idx+1]
-
-	child.keys = append(child.keys, n.keys[idx])
-	child.values = append(child.values, n.values[idx])
-	child.keys = append(child.keys, sibling.keys...)
-	child.values = append(child.values, sibling.values...)
-
-	if !child.isLeaf {
-		child.children = append(child.children, sibling.children...)
+// Diff compares t against other, treating other as the earlier state: added
+// keys are only in t, removed keys only in other, and changed keys are in
+// both with values valueEqual rejects. Both trees must use the same ordering;
+// their leaf chains are merged in a single pass and each list is in key order.
+func (t *BPlusTree[K, V]) Diff(other *BPlusTree[K, V], valueEqual func(V, V) bool) (added, removed, changed []K) {
+	a, b := t.Iterator(), other.Iterator()
+	okA, okB := a.Next(), b.Next()
+	for okA && okB {
+		switch ka, kb := a.Key(), b.Key(); {
+		case t.less(ka, kb):
+			added = append(added, ka)
+			okA = a.Next()
+		case t.less(kb, ka):
+			removed = append(removed, kb)
+			okB = b.Next()
+		default:
+			if !valueEqual(a.Value(), b.Value()) {
+				changed = append(changed, ka)
+			}
+			okA, okB = a.Next(), b.Next()
+		}
 	}
-
-	n.keys = append(n.keys[:idx], n.keys[idx+1:]...)
-	n.values = append(n.values[:idx], n.values[idx+1:]...)
-	n.children = append(n.children[:idx+1], n.children[idx+2:]...)
+	for ; okA; okA = a.Next() {
+		added = append(added, a.Key())
+	}
+	for ; okB; okB = b.Next() {
+		removed = append(removed, b.Key())
+	}
+	return added, removed, changed
 }
 
-// GET
-func (t *BPlusTree[K, V]) Get(key K) (V, bool) {
-	return t.Search(key)
+// Join calls fn, in key order, for every key present in both a and b with the
+// two values stored under it. Both trees must use the same ordering; their
+// leaf chains are walked in lockstep in a single linear pass.
+func Join[K comparable, V any, V2 any](a *BPlusTree[K, V], b *BPlusTree[K, V2], fn func(k K, va V, vb V2)) {
+	ia, ib := a.Iterator(), b.Iterator()
+	okA, okB := ia.Next(), ib.Next()
+	for okA && okB {
+		switch ka, kb := ia.Key(), ib.Key(); {
+		case a.less(ka, kb):
+			okA = ia.Next()
+		case a.less(kb, ka):
+			okB = ib.Next()
+		default:
+			fn(ka, ia.Value(), ib.Value())
+			okA, okB = ia.Next(), ib.Next()
+		}
+	}
 }
 
-// Clear resets the B+ Tree to an empty state.
-func (t *BPlusTree[K, V]) Clear() {
-	t.root = nil
+// GroupBy walks t in key order and calls fn once per run of consecutive keys
+// with the same groupKey, e.g. a day for time keys, passing the run's pairs.
+// Only the current run is held in memory. groupKey should be monotone in the
+// key order so each group forms a single run; otherwise a group that
+// reappears later gets another call. fn may keep entries, but must not write
+// to t.
+func GroupBy[K comparable, V any, G comparable](t *BPlusTree[K, V], groupKey func(K) G, fn func(g G, entries []Pair[K, V])) {
+	var group G
+	var entries []Pair[K, V]
+	t.ascend(func(k K, v V) bool {
+		if g := groupKey(k); len(entries) == 0 || g != group {
+			if len(entries) > 0 {
+				fn(group, entries)
+			}
+			group, entries = g, nil
+		}
+		entries = append(entries, Pair[K, V]{Key: k, Value: v})
+		return true
+	})
+	if len(entries) > 0 {
+		fn(group, entries)
+	}
 }
 
-func (t *BPlusTree[K, V]) Height() int {
-	return t.height(t.root)
+// Validate checks the structural invariants of the tree and returns the first
+// violation found, or nil if the tree is well-formed. Besides the nodes
+// themselves it checks the leaf chain, which the nodes can't vouch for.
+func (t *BPlusTree[K, V]) Validate() error {
+	if t.root == nil {
+		return nil
+	}
+	leafDepth := -1
+	if err := t.validate(t.root, 0, nil, nil, &leafDepth); err != nil {
+		return err
+	}
+	return t.validateChain()
 }
 
-// Helper method to calculate the height of the tree recursively
-func (t *BPlusTree[K, V]) height(node *BPlusTreeNode[K, V]) int {
-	if node == nil {
-		return 0
+// validateChain checks that following next links from the leftmost leaf
+// visits every leaf exactly once, in the order the tree structure puts
+// them, and so every key once in strictly ascending order, ending without a
+// cycle.
+func (t *BPlusTree[K, V]) validateChain() error {
+	var leaves []*BPlusTreeNode[K, V]
+	var collect func(n *BPlusTreeNode[K, V])
+	collect = func(n *BPlusTreeNode[K, V]) {
+		if n.isLeaf {
+			leaves = append(leaves, n)
+			return
+		}
+		for i := range n.children {
+			collect(n.child(i))
+		}
 	}
-	if node.isLeaf {
-		return 1
+	collect(t.root)
+
+	seen := make(map[*BPlusTreeNode[K, V]]bool, len(leaves))
+	visited, keys := 0, 0
+	var last *K
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		if seen[current] {
+			return fmt.Errorf("leaf chain loops back to an earlier leaf after %d leaves", visited)
+		}
+		seen[current] = true
+		if visited >= len(leaves) || leaves[visited] != current {
+			return fmt.Errorf("leaf chain step %d reaches a leaf out of order or outside the tree", visited)
+		}
+		for i := range current.keys {
+			if last != nil && !t.less(*last, current.keys[i]) {
+				return fmt.Errorf("leaf chain keys out of order: %v before %v", *last, current.keys[i])
+			}
+			last = &current.keys[i]
+		}
+		visited++
+		keys += len(current.keys)
+	}
+	if visited != len(leaves) {
+		return fmt.Errorf("leaf chain visits %d of %d leaves", visited, len(leaves))
+	}
+	if count := t.Count(); keys != count {
+		return fmt.Errorf("leaf chain visits %d keys, but the tree holds %d", keys, count)
 	}
-	return 1 + t.height(node.children[0]) // Height is the height of the first child + 1
+	return nil
 }
 
-// Update
-func (t *BPlusTree[K, V]) Update(key K, value V) error {
-	if _, found := t.Get(key); found {
-		t.Delete(key)        // First, delete the existing key-value pair
-		t.Insert(key, value) // Then insert the new one
+// validate checks node and its subtree, whose keys must all fall in [lo, hi).
+func (t *BPlusTree[K, V]) validate(node *BPlusTreeNode[K, V], depth int, lo *K, hi *K, leafDepth *int) error {
+	if len(node.keys) > t.MaxKeysPerNode() {
+		return fmt.Errorf("node at depth %d has %d keys, more than the maximum %d", depth, len(node.keys), t.MaxKeysPerNode())
+	}
+	if node != t.root && len(node.keys) < t.MinKeysPerNode() {
+		return fmt.Errorf("node at depth %d has %d keys, fewer than the minimum %d", depth, len(node.keys), t.MinKeysPerNode())
+	}
+	for i, key := range node.keys {
+		if i > 0 && !t.less(node.keys[i-1], key) {
+			return fmt.Errorf("keys out of order at depth %d: %v before %v", depth, node.keys[i-1], key)
+		}
+		if (lo != nil && t.less(key, *lo)) || (hi != nil && !t.less(key, *hi)) {
+			return fmt.Errorf("key %v at depth %d is outside its parent's separators", key, depth)
+		}
+	}
+
+	if node.isLeaf {
+		if len(node.values) != len(node.keys) {
+			return fmt.Errorf("leaf at depth %d has %d keys but %d values", depth, len(node.keys), len(node.values))
+		}
+		if *leafDepth == -1 {
+			*leafDepth = depth
+		} else if *leafDepth != depth {
+			return fmt.Errorf("leaves at depths %d and %d", *leafDepth, depth)
+		}
 		return nil
 	}
-	return fmt.Errorf("key '%v' not found for update", key)
+
+	if len(node.keys) == 0 {
+		return fmt.Errorf("internal node at depth %d has no keys", depth)
+	}
+	if len(node.children) != len(node.keys)+1 {
+		return fmt.Errorf("internal node at depth %d has %d keys but %d children", depth, len(node.keys), len(node.children))
+	}
+	for i := range node.children {
+		child := node.child(i)
+		childLo, childHi := lo, hi
+		if i > 0 {
+			childLo = &node.keys[i-1]
+		}
+		if i < len(node.keys) {
+			childHi = &node.keys[i]
+		}
+		if err := t.validate(child, depth+1, childLo, childHi, leafDepth); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// Exists checks if the given key exists in the B+ Tree.
-func (t *BPlusTree[K, V]) Exists(key K) bool {
-	_, found := t.Get(key)
-	return found
+// LeafSizes returns the key count of every leaf, left to right.
+func (t *BPlusTree[K, V]) LeafSizes() []int {
+	var sizes []int
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		sizes = append(sizes, len(current.keys))
+	}
+	return sizes
 }
 
-func (t *BPlusTree[K, V]) Count() int {
-	return t.count(t.root)
+// LeafCount returns the number of leaves, found by walking the leaf chain.
+// Count()/LeafCount() is the average number of keys per leaf.
+func (t *BPlusTree[K, V]) LeafCount() int {
+	n := 0
+	for current := t.leftmostLeaf(); current != nil; current = t.nextLeaf(current) {
+		n++
+	}
+	return n
 }
 
-// Helper method to count keys recursively
-func (t *BPlusTree[K, V]) count(node *BPlusTreeNode[K, V]) int {
-	if node == nil {
+// RelinkLeaves rebuilds the leaf chain from the tree structure itself,
+// pointing each leaf's next link at the leaf after it in an in-order walk and
+// ending the chain at the last. It is a repair tool for after low-level
+// edits made to nodes directly, which Range, Traverse and the iterators rely
+// on the chain being right for. It returns how many links it had to change.
+// A tree sharing nodes with another version ignores its links anyway; it
+// takes its own copy, which comes freshly linked.
+func (t *BPlusTree[K, V]) RelinkLeaves() int {
+	if t.cow {
+		t.own()
 		return 0
 	}
-	if node.isLeaf {
-		return len(node.keys)
+	fixed := 0
+	var prev *BPlusTreeNode[K, V]
+	var walk func(n *BPlusTreeNode[K, V])
+	walk = func(n *BPlusTreeNode[K, V]) {
+		if !n.isLeaf {
+			for i := range n.children {
+				walk(n.child(i))
+			}
+			return
+		}
+		if prev != nil && prev.next != n {
+			prev.next = n
+			fixed++
+		}
+		prev = n
 	}
-	count := 0
-	for _, child := range node.children {
-		count += t.count(child)
+	if t.root != nil {
+		walk(t.root)
 	}
-	return count
-}
-
-// List retrieves all keys from the B+ Tree.
-func (t *BPlusTree[K, V]) List() []K {
-	var keys []K
-	t.list(t.root, &keys)
-	return keys
+	if prev != nil && prev.next != nil {
+		prev.next = nil
+		fixed++
+	}
+	return fixed
 }
 
-// Helper method to collect keys recursively
-func (t *BPlusTree[K, V]) list(node *BPlusTreeNode[K, V], keys *[]K) {
-	if node == nil {
-		return
-	}
-	if node.isLeaf {
-		*keys = append(*keys, node.keys...)
-		return
+// InternalSizes returns the key count of every internal node, one slice per
+// level from the root down, each left to right.
+func (t *BPlusTree[K, V]) InternalSizes() [][]int {
+	var levels [][]int
+	if t.root == nil {
+		return levels
 	}
-	for i := 0; i < len(node.keys); i++ {
-		t.list(node.children[i], keys)
-		*keys = append(*keys, node.keys[i])
+	level := []*BPlusTreeNode[K, V]{t.root}
+	for len(level) > 0 && !level[0].isLeaf {
+		sizes := make([]int, 0, len(level))
+		var next []*BPlusTreeNode[K, V]
+		for _, n := range level {
+			sizes = append(sizes, len(n.keys))
+			for i := range n.children {
+				next = append(next, n.child(i))
+			}
+		}
+		levels = append(levels, sizes)
+		level = next
 	}
-	t.list(node.children[len(node.children)-1], keys) // last child
+	return levels
 }
 
-// Range retrieves all key-value pairs within a given range.
-func (t *BPlusTree[K, V]) Range(start K, end K) map[K]V {
-	result := make(map[K]V)
-	current := t.root
-	for !current.isLeaf {
-		current = current.children[0]
-	}
+// LevelStat summarizes one level of the tree.
+type LevelStat struct {
+	Level   int // 0 is the root
+	Nodes   int
+	AvgKeys float64
+	Fill    float64 // AvgKeys as a fraction of MaxKeysPerNode
+}
 
-	for current != nil {
-		for i := 0; i < len(current.keys); i++ {
-			if t.less(start, current.keys[i]) && t.less(current.keys[i], end) {
-				result[current.keys[i]] = current.values[i]
+// LevelStats returns node counts and average occupancy per level from the
+// root down to the leaves, e.g. to spot leaves left sparse by deletes.
+func (t *BPlusTree[K, V]) LevelStats() []LevelStat {
+	var stats []LevelStat
+	if t.root == nil {
+		return stats
+	}
+	level := []*BPlusTreeNode[K, V]{t.root}
+	for depth := 0; len(level) > 0; depth++ {
+		keys := 0
+		var next []*BPlusTreeNode[K, V]
+		for _, n := range level {
+			keys += len(n.keys)
+			for i := range n.children {
+				next = append(next, n.child(i))
 			}
 		}
-		current = current.next
+		avg := float64(keys) / float64(len(level))
+		stats = append(stats, LevelStat{
+			Level:   depth,
+			Nodes:   len(level),
+			AvgKeys: avg,
+			Fill:    avg / float64(t.MaxKeysPerNode()),
+		})
+		level = next
 	}
-	return result
+	return stats
 }
 
 // Stats returns the statistics of the B+ Tree.
@@ -428,13 +2351,69 @@ func (t *BPlusTree[K, V]) Stats() string {
 	return fmt.Sprintf("Total keys: %d, Height: %d", t.Count(), t.Height())
 }
 
+// splitArgs splits a REPL line into words like strings.Fields, except that a
+// double-quoted section may contain spaces and keeps them. Inside quotes, \"
+// and \\ stand for a quote and a backslash; "" is an empty word.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var word strings.Builder
+	inWord, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line) && (line[i+1] == '"' || line[i+1] == '\\'):
+			i++
+			word.WriteByte(line[i])
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// checkArgs reports whether a REPL command got exactly the named arguments,
+// printing what is missing or extra along with its usage if not.
+func checkArgs(parts []string, names ...string) bool {
+	got := len(parts) - 1
+	if got == len(names) {
+		return true
+	}
+	usage := parts[0]
+	for _, name := range names {
+		usage += " <" + name + ">"
+	}
+	if got < len(names) {
+		color.Red("Missing <%s>. Usage: %s\n", names[got], usage)
+	} else {
+		color.Red("Too many arguments (quote values containing spaces). Usage: %s\n", usage)
+	}
+	return false
+}
+
 func main() {
-	tree := NewBPlusTree[string, string](3, func(a, b string) bool { return a < b }, func(a, b string) bool { return a == b })
+	tree := NewBPlusTree[string, string](3, StringLess, StringEqual)
 
 	scanner := bufio.NewScanner(os.Stdin)
 	color.Cyan("Welcome to the B+ Tree REPL!")
 	color.Yellow("Commands:")
-	color.Green("  insert <key> <value> - Insert a key-value pair into the B+ Tree")
+	color.Green("  insert <key> <value> - Insert a key-value pair, overwriting an existing key")
+	color.Green("    (wrap keys or values containing spaces in double quotes)")
 	color.Green("  delete <key> - Delete a key from the B+ Tree")
 	color.Green("  update <key> <value> - Update the value for a key")
 	color.Green("  exists <key> - Check if a key exists")
@@ -445,40 +2424,52 @@ func main() {
 	color.Green("  get <key> - Retrieve a value by key")
 	color.Green("  clear - Clear the B+ Tree")
 	color.Green("  height - Get the height of the B+ Tree")
+	color.Green("  check - Verify the tree's invariants and report the first violation")
+	color.Green("  explain <key> - Describe how deleting a key would rebalance the tree")
+	color.Green("  match <pattern> - List pairs whose keys match a glob with * and ?")
 	color.Green("  exit - Exit")
 
 	for {
 		color.Magenta("TheViχhal 𓅇  >  ")
 		scanner.Scan()
 		input := scanner.Text()
-		parts := strings.Fields(input)
+		parts, err := splitArgs(input)
+		if err != nil {
+			color.Red("Error: %s\n", err)
+			continue
+		}
 		if len(parts) == 0 {
 			continue
 		}
 
 		switch parts[0] {
 		case "insert":
-			if len(parts) != 3 {
-				color.Red("Usage: insert <key> <value>")
+			if !checkArgs(parts, "key", "value") {
 				continue
 			}
 			key := parts[1]
 			value := parts[2]
+			existed := tree.Exists(key)
 			tree.Insert(key, value)
-			color.Green("Inserted: %s:%s\n", key, value)
+			if existed {
+				color.Yellow("Overwrote: %s:%s\n", key, value)
+			} else {
+				color.Green("Inserted: %s:%s\n", key, value)
+			}
 
 		case "delete":
-			if len(parts) != 2 {
-				color.Red("Usage: delete <key>")
+			if !checkArgs(parts, "key") {
 				continue
 			}
 			key := parts[1]
-			tree.Delete(key)
-			color.Green("Deleted: %s\n", key)
+			if _, found := tree.Remove(key); found {
+				color.Green("Deleted: %s\n", key)
+			} else {
+				color.Red("Key '%s' not found.\n", key)
+			}
 
 		case "update":
-			if len(parts) != 3 {
-				color.Red("Usage: update <key> <value>")
+			if !checkArgs(parts, "key", "value") {
 				continue
 			}
 			key := parts[1]
@@ -490,8 +2481,7 @@ func main() {
 			}
 
 		case "exists":
-			if len(parts) != 2 {
-				color.Red("Usage: exists <key>")
+			if !checkArgs(parts, "key") {
 				continue
 			}
 			key := parts[1]
@@ -510,8 +2500,7 @@ func main() {
 			color.Green("Keys: %v\n", keys)
 
 		case "range":
-			if len(parts) != 3 {
-				color.Red("Usage: range <start> <end>")
+			if !checkArgs(parts, "start", "end") {
 				continue
 			}
 			start := parts[1]
@@ -526,8 +2515,7 @@ func main() {
 			tree.Traverse()
 
 		case "get":
-			if len(parts) != 2 {
-				color.Red("Usage: get <key>")
+			if !checkArgs(parts, "key") {
 				continue
 			}
 			key := parts[1]
@@ -546,6 +2534,29 @@ func main() {
 			height := tree.Height()
 			color.Green("Height of the B+ Tree: %d\n", height)
 
+		case "check":
+			if err := tree.Validate(); err != nil {
+				color.Red("FAIL: %s\n", err)
+			} else {
+				color.Green("PASS: %d keys, height %d, all invariants hold\n", tree.Count(), tree.Height())
+			}
+
+		case "explain":
+			if !checkArgs(parts, "key") {
+				continue
+			}
+			color.Cyan(tree.ExplainDelete(parts[1]))
+
+		case "match":
+			if !checkArgs(parts, "pattern") {
+				continue
+			}
+			pairs := MatchGlob(tree, parts[1])
+			color.Green("Matched %d keys:", len(pairs))
+			for _, p := range pairs {
+				color.Green("  %s: %s\n", p.Key, p.Value)
+			}
+
 		case "exit":
 			color.Green("Exiting...")
 			return
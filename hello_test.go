@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// checkNodeSizes walks every node of t and fails if one holds more keys than
+// MaxKeysPerNode, or, below the root, fewer than MinKeysPerNode.
+func checkNodeSizes[K comparable, V any](tb testing.TB, t *BPlusTree[K, V]) {
+	tb.Helper()
+	var walk func(n *BPlusTreeNode[K, V], depth int)
+	walk = func(n *BPlusTreeNode[K, V], depth int) {
+		if len(n.keys) > t.MaxKeysPerNode() {
+			tb.Fatalf("node at depth %d has %d keys, max %d", depth, len(n.keys), t.MaxKeysPerNode())
+		}
+		if n != t.root && len(n.keys) < t.MinKeysPerNode() {
+			tb.Fatalf("node at depth %d has %d keys, min %d", depth, len(n.keys), t.MinKeysPerNode())
+		}
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+	}
+	walk(t.root, 0)
+}
+
+func TestRandomInsertDelete(t *testing.T) {
+	tests := []struct {
+		order int
+		keys  int
+		ops   int
+	}{
+		{order: 3, keys: 200, ops: 3000},
+		{order: 4, keys: 300, ops: 3000},
+		{order: 5, keys: 400, ops: 3000},
+		{order: 6, keys: 500, ops: 3000},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("order=%d", tt.order), func(t *testing.T) {
+			rng := rand.New(rand.NewSource(int64(tt.order)))
+			tree := NewBPlusTree[int, int](tt.order, IntLess, IntEqual)
+			want := make(map[int]int)
+			height := 0
+			for op := 0; op < tt.ops; op++ {
+				key := rng.Intn(tt.keys)
+				// Lean towards inserts so the tree grows deep enough for
+				// splits and merges at several levels
+				if rng.Intn(3) > 0 {
+					if err := tree.Insert(key, op); err != nil {
+						t.Fatalf("insert %d: %v", key, err)
+					}
+					want[key] = op
+				} else {
+					if err := tree.Delete(key); err != nil {
+						t.Fatalf("delete %d: %v", key, err)
+					}
+					delete(want, key)
+				}
+				if err := tree.Validate(); err != nil {
+					t.Fatalf("after op %d on key %d: %v", op, key, err)
+				}
+				checkNodeSizes(t, tree)
+				height = max(height, tree.Height())
+			}
+			if height < 3 {
+				t.Fatalf("tree only reached height %d; too few keys to split internal nodes", height)
+			}
+			if got := tree.Count(); got != len(want) {
+				t.Fatalf("Count() = %d, want %d", got, len(want))
+			}
+			for k, v := range want {
+				if got, ok := tree.Search(k); !ok || got != v {
+					t.Fatalf("Search(%d) = %d, %v, want %d, true", k, got, ok, v)
+				}
+			}
+			// Drain everything to exercise merges all the way back to a leaf root
+			for k := range want {
+				tree.Delete(k)
+				if err := tree.Validate(); err != nil {
+					t.Fatalf("draining %d: %v", k, err)
+				}
+				checkNodeSizes(t, tree)
+			}
+			if tree.Count() != 0 {
+				t.Fatalf("Count() = %d after deleting every key", tree.Count())
+			}
+		})
+	}
+}
+
+// Every read on an empty tree, whether new or emptied by Clear, should
+// return its zero result rather than panic.
+func TestEmptyTree(t *testing.T) {
+	cleared := NewBPlusTree[int, int](4, IntLess, IntEqual)
+	for i := 0; i < 100; i++ {
+		cleared.Insert(i, i)
+	}
+	if err := cleared.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	empty := NewBPlusTree[int, int](4, IntLess, IntEqual)
+	trees := map[string]*BPlusTree[int, int]{"new": empty, "cleared": cleared}
+	for name, tree := range trees {
+		t.Run(name, func(t *testing.T) {
+			if v, ok := tree.Get(1); ok || v != 0 {
+				t.Errorf("Get = %d, %v", v, ok)
+			}
+			if err := tree.Delete(1); err != nil {
+				t.Errorf("Delete: %v", err)
+			}
+			if v, ok := tree.Remove(1); ok || v != 0 {
+				t.Errorf("Remove = %d, %v", v, ok)
+			}
+			if got := tree.Range(0, 10); len(got) != 0 {
+				t.Errorf("Range = %v", got)
+			}
+			if _, _, err := tree.Min(); !errors.Is(err, ErrEmptyTree) {
+				t.Errorf("Min error = %v, want ErrEmptyTree", err)
+			}
+			if _, _, err := tree.Max(); !errors.Is(err, ErrEmptyTree) {
+				t.Errorf("Max error = %v, want ErrEmptyTree", err)
+			}
+			if _, _, ok := tree.KeyRange(); ok {
+				t.Error("KeyRange reported keys")
+			}
+			if got := tree.LastN(3); len(got) != 0 {
+				t.Errorf("LastN = %v", got)
+			}
+			if _, _, ok := tree.Closest(5, func(a, b int) float64 { return float64(a - b) }); ok {
+				t.Error("Closest found a key")
+			}
+			if _, ok := tree.Quantile(0.5); ok {
+				t.Error("Quantile found a key")
+			}
+			if c := tree.Cursor(); c.Next() || c.Err() != nil {
+				t.Errorf("Cursor.Next = true or Err = %v", c.Err())
+			}
+			if it := tree.Iterator(); it.Next() || it.Err() != nil {
+				t.Errorf("Iterator.Next = true or Err = %v", it.Err())
+			}
+			if it := tree.KeysIterator(); it.Next() || it.Err() != nil {
+				t.Errorf("KeysIterator.Next = true or Err = %v", it.Err())
+			}
+			for k := range tree.All() {
+				t.Errorf("All yielded %d", k)
+			}
+			for k := range tree.Backward() {
+				t.Errorf("Backward yielded %d", k)
+			}
+			tree.Traverse()
+			if err := tree.Validate(); err != nil {
+				t.Errorf("Validate: %v", err)
+			}
+			if tree.Count() != 0 || tree.Height() != 1 {
+				t.Errorf("Count = %d, Height = %d", tree.Count(), tree.Height())
+			}
+		})
+	}
+	if empty.ContentHash() != cleared.ContentHash() {
+		t.Error("ContentHash differs between a new and a cleared tree")
+	}
+}
+
+// Sequential keys always land in the rightmost leaf, the pattern that used
+// to leave an empty node behind a split.
+func TestSequentialInsertLeavesNoEmptyNode(t *testing.T) {
+	for order := 3; order <= 10; order++ {
+		for _, descending := range []bool{false, true} {
+			t.Run(fmt.Sprintf("order=%d/descending=%v", order, descending), func(t *testing.T) {
+				tree := NewBPlusTree[int, int](order, IntLess, IntEqual)
+				n := 3 * tree.MaxKeysPerNode()
+				for i := 0; i < n; i++ {
+					key := i
+					if descending {
+						key = n - i
+					}
+					tree.Insert(key, i)
+					if err := tree.Validate(); err != nil {
+						t.Fatalf("after inserting %d: %v", key, err)
+					}
+					checkNodeSizes(t, tree)
+				}
+				var walk func(n *BPlusTreeNode[int, int])
+				walk = func(n *BPlusTreeNode[int, int]) {
+					if len(n.keys) == 0 {
+						t.Fatalf("empty node in a tree of %d keys", tree.Count())
+					}
+					for _, c := range n.children {
+						walk(c)
+					}
+				}
+				walk(tree.root)
+				if tree.Count() != n {
+					t.Fatalf("Count() = %d, want %d", tree.Count(), n)
+				}
+			})
+		}
+	}
+}
+
+// Benchmarks run each operation over benchKeys keys in random order at each
+// of benchOrders, e.g.
+//
+//	go test -run '^$' -bench . -benchmem
+var benchOrders = []int{4, 8, 16, 32, 64}
+
+const benchKeys = 100_000
+
+func benchKeysShuffled() []int {
+	return rand.New(rand.NewSource(1)).Perm(benchKeys)
+}
+
+func benchTree(order int, keys []int) *BPlusTree[int, string] {
+	tree := NewBPlusTree[int, string](order, IntLess, IntEqual)
+	for _, k := range keys {
+		tree.Insert(k, strconv.Itoa(k))
+	}
+	return tree
+}
+
+func BenchmarkInsert(b *testing.B) {
+	keys := benchKeysShuffled()
+	for _, order := range benchOrders {
+		b.Run(fmt.Sprintf("order=%d", order), func(b *testing.B) {
+			var tree *BPlusTree[int, string]
+			for i := 0; i < b.N; i++ {
+				// Start over each time the keys run out, so every insert
+				// goes into a tree of at most benchKeys keys
+				if i%benchKeys == 0 {
+					b.StopTimer()
+					tree = NewBPlusTree[int, string](order, IntLess, IntEqual)
+					b.StartTimer()
+				}
+				tree.Insert(keys[i%benchKeys], "")
+			}
+		})
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	keys := benchKeysShuffled()
+	for _, order := range benchOrders {
+		b.Run(fmt.Sprintf("order=%d", order), func(b *testing.B) {
+			tree := benchTree(order, keys)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, ok := tree.Search(keys[i%benchKeys]); !ok {
+					b.Fatal("missing key")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRange reads 100 consecutive pairs per operation.
+func BenchmarkRange(b *testing.B) {
+	keys := benchKeysShuffled()
+	for _, order := range benchOrders {
+		b.Run(fmt.Sprintf("order=%d", order), func(b *testing.B) {
+			tree := benchTree(order, keys)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := keys[i%benchKeys] % (benchKeys - 100)
+				if got, _ := tree.RangeColumns(start, start+99); len(got) != 100 {
+					b.Fatalf("range from %d returned %d keys", start, len(got))
+				}
+			}
+		})
+	}
+}
+
+// largeValue stands in for a big value type stored inline in the leaves.
+type largeValue [1024]byte
+
+// BenchmarkLargeValues inserts and deletes one key per operation in a tree
+// of 1KB values, stored inline and behind a pointer, to show the cost of
+// shifting values within leaves.
+func BenchmarkLargeValues(b *testing.B) {
+	const size = 10_000
+	keys := rand.New(rand.NewSource(1)).Perm(size)
+	b.Run("inline", func(b *testing.B) {
+		tree := NewBPlusTree[int, largeValue](16, IntLess, IntEqual)
+		for _, k := range keys {
+			tree.Insert(2*k, largeValue{})
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// Odd keys fall between the stored even ones
+			key := 2*keys[i%size] + 1
+			tree.Insert(key, largeValue{})
+			tree.Delete(key)
+		}
+	})
+	b.Run("pointer", func(b *testing.B) {
+		tree := NewBPlusTree[int, *largeValue](16, IntLess, IntEqual)
+		for _, k := range keys {
+			tree.Insert(2*k, &largeValue{})
+		}
+		v := &largeValue{}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			key := 2*keys[i%size] + 1
+			tree.Insert(key, v)
+			tree.Delete(key)
+		}
+	})
+}
+
+// bulkPairs is n sorted pairs for the bulk loading benchmarks.
+func bulkPairs(n int) []Pair[int, int] {
+	pairs := make([]Pair[int, int], n)
+	for i := range pairs {
+		pairs[i] = Pair[int, int]{Key: i, Value: i}
+	}
+	return pairs
+}
+
+// BenchmarkBulkLoad builds a tree of 1M sorted pairs at order 32 per
+// operation; allocs/op shows how many node slices the builder allocates.
+func BenchmarkBulkLoad(b *testing.B) {
+	pairs := bulkPairs(1_000_000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := BulkLoad(pairs, 32, IntLess, IntEqual); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkFromMap is BenchmarkBulkLoad from an unsorted map, so it also
+// pays for collecting and sorting the keys.
+func BenchmarkFromMap(b *testing.B) {
+	m := make(map[int]int, 1_000_000)
+	for _, p := range bulkPairs(1_000_000) {
+		m[p.Key] = p.Value
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		FromMap(m, 32, IntLess, IntEqual)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+// mutationHooks holds the callbacks registered with OnInsert, OnDelete and
+// OnUpdate. Each fires after the tree has been changed.
+type mutationHooks[K comparable, V any] struct {
+	insert []func(k K, v V)
+	delete []func(k K, v V)
+	update []func(k K, old V, new V)
+}
+
+// OnInsert registers fn to be called whenever a new key is added.
+func (t *BPlusTree[K, V]) OnInsert(fn func(k K, v V)) {
+	t.hooks.insert = append(t.hooks.insert, fn)
+}
+
+// OnDelete registers fn to be called with the removed pair whenever a key is
+// deleted, including by Clear and LRU eviction.
+func (t *BPlusTree[K, V]) OnDelete(fn func(k K, v V)) {
+	t.hooks.delete = append(t.hooks.delete, fn)
+}
+
+// OnUpdate registers fn to be called whenever an existing key's value is
+// replaced, by Insert on an existing key, by Update, or by Reindex resolving
+// a collision. It fires even when the new value equals the old one.
+func (t *BPlusTree[K, V]) OnUpdate(fn func(k K, old V, new V)) {
+	t.hooks.update = append(t.hooks.update, fn)
+}
+
+func (h *mutationHooks[K, V]) fireInsert(k K, v V) {
+	for _, fn := range h.insert {
+		fn(k, v)
+	}
+}
+
+func (h *mutationHooks[K, V]) fireDelete(k K, v V) {
+	for _, fn := range h.delete {
+		fn(k, v)
+	}
+}
+
+func (h *mutationHooks[K, V]) fireUpdate(k K, old V, new V) {
+	for _, fn := range h.update {
+		fn(k, old, new)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ImportReport accounts for every non-blank line ImportWithReport read, by
+// 1-based line number.
+type ImportReport struct {
+	Inserted   []int
+	Duplicates []int // Key already present, from the tree or an earlier line; the first value is kept
+	Failures   []LineError
+}
+
+// LineError is an input line ImportWithReport could not use and why: parse
+// failed on it or the key validator refused its key.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// ImportWithReport inserts one pair per line of r, as turned into a key and
+// value by parse, skipping blank lines. Nothing is dropped silently: lines
+// repeating a key are left out and listed as duplicates, and lines that fail
+// are listed with their error, so the import can be audited. The error is
+// only for failures reading r.
+func (t *BPlusTree[K, V]) ImportWithReport(r io.Reader, parse func(string) (K, V, error)) (ImportReport, error) {
+	var report ImportReport
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" {
+			continue
+		}
+		key, value, err := parse(text)
+		if err != nil {
+			report.Failures = append(report.Failures, LineError{Line: line, Err: err})
+			continue
+		}
+		if t.Exists(key) {
+			report.Duplicates = append(report.Duplicates, line)
+			continue
+		}
+		if err := t.Insert(key, value); err != nil {
+			report.Failures = append(report.Failures, LineError{Line: line, Err: err})
+			continue
+		}
+		report.Inserted = append(report.Inserted, line)
+	}
+	return report, scanner.Err()
+}
+
+// loadBufferSize is how much of the file LoadSortedFile reads at a time.
+const loadBufferSize = 1 << 20
+
+// LoadSortedFile replaces t's contents, as ReplaceAll does, with one pair per
+// line of the file at path, for fast startup from a file already sorted by
+// key. The file is read in large buffered chunks and each line handed to
+// parse as raw bytes, without the newline or a string conversion; the slice
+// is only valid until parse returns. The pairs feed the bulk loader directly
+// rather than being inserted one by one, so the keys must be strictly
+// increasing; blank lines are skipped.
+//
+// If a line fails to parse, its key is refused by the key validator or is out
+// of order, t is left unchanged and the error names the line.
+func (t *BPlusTree[K, V]) LoadSortedFile(path string, parse func([]byte) (K, V, error)) error {
+	if err := t.writable("load"); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b := &bulkBuilder[K, V]{tree: &BPlusTree[K, V]{order: t.order, less: t.less, equal: t.equal, alloc: t.alloc}}
+	r := bufio.NewReaderSize(f, loadBufferSize)
+	for line := 1; ; line++ {
+		text, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			// A line longer than the buffer: copy what was read before the
+			// buffer is reused, then collect the rest
+			head := append([]byte(nil), text...)
+			var rest []byte
+			rest, err = r.ReadBytes('\n')
+			text = append(head, rest...)
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("load %s line %d: %w", path, line, err)
+		}
+		text = bytes.TrimRight(text, "\r\n")
+		if len(text) > 0 {
+			key, value, perr := parse(text)
+			if perr != nil {
+				return fmt.Errorf("load %s line %d: %w", path, line, perr)
+			}
+			key = t.norm(key)
+			if aerr := t.admit("load", key); aerr != nil {
+				return fmt.Errorf("load %s line %d: %w", path, line, aerr)
+			}
+			key, value = t.copyIn(key, value)
+			if serr := b.addSorted(key, value); serr != nil {
+				return fmt.Errorf("load %s line %d: %w", path, line, serr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	t.install(b.finish().root)
+	return nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IndexedTree is a primary key -> value tree plus any number of named
+// secondary indexes, each a B+ Tree from a derived index key to the primary
+// keys whose values produce it. The primary tree is authoritative; indexes
+// follow it through its mutation hooks, so writes made directly on Primary()
+// are indexed too.
+type IndexedTree[K comparable, V any] struct {
+	primary *BPlusTree[K, V]
+	indexes map[string]secondaryIndex[K, V]
+}
+
+// secondaryIndex hides the index key type so indexes of different key types
+// can live side by side.
+type secondaryIndex[K comparable, V any] interface {
+	add(k K, v V)
+	remove(k K, v V)
+	lookup(value any) ([]K, error)
+}
+
+type treeIndex[K comparable, V any, I comparable] struct {
+	extract func(V) I
+	tree    *BPlusTree[I, []K]
+	less    func(K, K) bool // Primary key order, keeping each key list sorted
+	equal   func(K, K) bool
+}
+
+func NewIndexedTree[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool) *IndexedTree[K, V] {
+	it := &IndexedTree[K, V]{
+		primary: NewBPlusTree[K, V](order, less, equal),
+		indexes: make(map[string]secondaryIndex[K, V]),
+	}
+	it.primary.OnInsert(func(k K, v V) {
+		for _, idx := range it.indexes {
+			idx.add(k, v)
+		}
+	})
+	it.primary.OnDelete(func(k K, v V) {
+		for _, idx := range it.indexes {
+			idx.remove(k, v)
+		}
+	})
+	it.primary.OnUpdate(func(k K, old V, new V) {
+		for _, idx := range it.indexes {
+			idx.remove(k, old)
+			idx.add(k, new)
+		}
+	})
+	return it
+}
+
+// AddIndex defines a secondary index called name over extract(value) and
+// builds it from the entries already in the primary tree. Replacing an
+// existing index of the same name rebuilds it.
+func AddIndex[K comparable, V any, I comparable](it *IndexedTree[K, V], name string, extract func(V) I, less func(I, I) bool, equal func(I, I) bool) {
+	idx := &treeIndex[K, V, I]{
+		extract: extract,
+		tree:    NewBPlusTree[I, []K](it.primary.order, less, equal),
+		less:    it.primary.less,
+		equal:   it.primary.equal,
+	}
+	it.primary.ascend(func(k K, v V) bool {
+		idx.add(k, v)
+		return true
+	})
+	it.indexes[name] = idx
+}
+
+// Primary returns the authoritative key -> value tree.
+func (it *IndexedTree[K, V]) Primary() *BPlusTree[K, V] {
+	return it.primary
+}
+
+func (it *IndexedTree[K, V]) Insert(key K, value V) {
+	it.primary.Insert(key, value)
+}
+
+func (it *IndexedTree[K, V]) Delete(key K) {
+	it.primary.Delete(key)
+}
+
+func (it *IndexedTree[K, V]) Update(key K, value V) error {
+	return it.primary.Update(key, value)
+}
+
+func (it *IndexedTree[K, V]) Get(key K) (V, bool) {
+	return it.primary.Get(key)
+}
+
+// ByIndex returns, in primary key order, the keys whose value maps to value
+// under the named index. value must have the index's key type.
+func (it *IndexedTree[K, V]) ByIndex(name string, value any) ([]K, error) {
+	idx, ok := it.indexes[name]
+	if !ok {
+		return nil, fmt.Errorf("no index named '%s'", name)
+	}
+	return idx.lookup(value)
+}
+
+func (x *treeIndex[K, V, I]) add(k K, v V) {
+	ik := x.extract(v)
+	keys, _ := x.tree.Search(ik)
+	pos := sort.Search(len(keys), func(i int) bool { return !x.less(keys[i], k) })
+	if pos < len(keys) && x.equal(keys[pos], k) {
+		return
+	}
+	// Build a fresh slice so the stored one never aliases a caller's
+	grown := make([]K, 0, len(keys)+1)
+	grown = append(append(append(grown, keys[:pos]...), k), keys[pos:]...)
+	x.tree.Insert(ik, grown)
+}
+
+func (x *treeIndex[K, V, I]) remove(k K, v V) {
+	ik := x.extract(v)
+	keys, found := x.tree.Search(ik)
+	if !found {
+		return
+	}
+	pos := sort.Search(len(keys), func(i int) bool { return !x.less(keys[i], k) })
+	if pos == len(keys) || !x.equal(keys[pos], k) {
+		return
+	}
+	if len(keys) == 1 {
+		x.tree.Delete(ik)
+		return
+	}
+	shrunk := make([]K, 0, len(keys)-1)
+	shrunk = append(append(shrunk, keys[:pos]...), keys[pos+1:]...)
+	x.tree.Insert(ik, shrunk)
+}
+
+func (x *treeIndex[K, V, I]) lookup(value any) ([]K, error) {
+	ik, ok := value.(I)
+	if !ok {
+		return nil, fmt.Errorf("index key %v has type %T, want %T", value, value, *new(I))
+	}
+	keys, _ := x.tree.Search(ik)
+	return append([]K(nil), keys...), nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import "iter"
+
+// KeyIterator walks the keys of a B+ Tree in ascending order one at a time,
+// following the leaf chain instead of collecting every key up front like List.
+// It fails fast like Iterator if keys are added or removed meanwhile.
+type KeyIterator[K comparable, V any] struct {
+	tree     *BPlusTree[K, V]
+	leaf     *BPlusTreeNode[K, V]
+	idx      int
+	modCount uint64
+	err      error
+}
+
+// KeysIterator returns an iterator positioned before the smallest key.
+// Call Next before the first Key.
+func (t *BPlusTree[K, V]) KeysIterator() *KeyIterator[K, V] {
+	return &KeyIterator[K, V]{tree: t, leaf: t.leftmostLeaf(), idx: -1, modCount: t.modCount}
+}
+
+// Next advances to the next key and reports whether there is one.
+func (it *KeyIterator[K, V]) Next() bool {
+	if it.leaf == nil || it.err != nil {
+		return false
+	}
+	if it.tree.modCount != it.modCount {
+		it.err = ErrConcurrentModification
+		return false
+	}
+	it.idx++
+	// Skip to the next leaf, passing over any that are empty
+	for it.leaf != nil && it.idx >= len(it.leaf.keys) {
+		it.leaf = it.tree.nextLeaf(it.leaf)
+		it.idx = 0
+	}
+	return it.leaf != nil
+}
+
+// Key returns the key at the current position.
+func (it *KeyIterator[K, V]) Key() K {
+	return it.leaf.keys[it.idx]
+}
+
+// Err returns ErrConcurrentModification if iteration stopped because the
+// tree changed, or nil if it simply ran out of keys.
+func (it *KeyIterator[K, V]) Err() error {
+	return it.err
+}
+
+// Iterator walks the pairs of a B+ Tree in ascending key order. It reads the
+// live nodes, so the tree must not be modified while it is in use; with a
+// ConcurrentBPlusTree that means iterating inside View, or using
+// SnapshotIterator instead. If keys are added or removed anyway, the next
+// call to Next returns false and Err reports ErrConcurrentModification
+// rather than skipping or repeating keys.
+type Iterator[K comparable, V any] struct {
+	tree     *BPlusTree[K, V]
+	leaf     *BPlusTreeNode[K, V]
+	idx      int
+	modCount uint64
+	err      error
+}
+
+// Iterator returns an iterator positioned before the smallest key.
+// Call Next before the first Key or Value.
+func (t *BPlusTree[K, V]) Iterator() *Iterator[K, V] {
+	return &Iterator[K, V]{tree: t, leaf: t.leftmostLeaf(), idx: -1, modCount: t.modCount}
+}
+
+// SnapshotIterator returns an iterator over the tree as it is now, which
+// later writes to the tree don't affect. Taking the snapshot is O(1): the
+// nodes are shared copy-on-write, and the next write copies them instead.
+func (t *BPlusTree[K, V]) SnapshotIterator() *Iterator[K, V] {
+	return t.snapshot().Iterator()
+}
+
+// Next advances to the next pair and reports whether there is one.
+func (it *Iterator[K, V]) Next() bool {
+	if it.leaf == nil || it.err != nil {
+		return false
+	}
+	if it.tree.modCount != it.modCount {
+		it.err = ErrConcurrentModification
+		return false
+	}
+	it.idx++
+	for it.leaf != nil && it.idx >= len(it.leaf.keys) {
+		it.leaf = it.tree.nextLeaf(it.leaf)
+		it.idx = 0
+	}
+	return it.leaf != nil
+}
+
+// Key returns the key at the current position.
+func (it *Iterator[K, V]) Key() K {
+	return it.leaf.keys[it.idx]
+}
+
+// Value returns the value at the current position.
+func (it *Iterator[K, V]) Value() V {
+	return it.leaf.values[it.idx]
+}
+
+// Err returns ErrConcurrentModification if iteration stopped because the
+// tree changed, or nil if it simply ran out of pairs.
+func (it *Iterator[K, V]) Err() error {
+	return it.err
+}
+
+// All returns the pairs in ascending key order for use with range:
+//
+//	for k, v := range tree.All() { ... }
+//
+// As with Iterator, the tree must not change while the loop runs.
+func (t *BPlusTree[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t.ascend(yield)
+	}
+}
+
+// Backward returns the pairs in descending key order.
+func (t *BPlusTree[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t.descend(yield)
+	}
+}
+
+// RangeSeq returns the pairs with keys in [start, end] in ascending order.
+func (t *BPlusTree[K, V]) RangeSeq(start K, end K) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		t.ascendRange(start, end, yield)
+	}
+}
+
+// Cursor walks the pairs of a B+ Tree in ascending key order like Iterator,
+// but can also delete the pair it is on. Because a delete can merge or
+// redistribute leaves, the cursor doesn't trust its position afterwards:
+// the next call to Next finds its place again from the root by the deleted
+// key. Writes made other than through Delete stop it with
+// ErrConcurrentModification as with Iterator.
+type Cursor[K comparable, V any] struct {
+	tree     *BPlusTree[K, V]
+	leaf     *BPlusTreeNode[K, V]
+	idx      int
+	modCount uint64
+	err      error
+	key      K
+	value    V
+	valid    bool // On a pair that hasn't been deleted
+	reseek   bool // The current pair was deleted; leaf and idx are stale
+}
+
+// Cursor returns a cursor positioned before the smallest key.
+// Call Next before the first Key, Value or Delete.
+func (t *BPlusTree[K, V]) Cursor() *Cursor[K, V] {
+	return &Cursor[K, V]{tree: t, leaf: t.leftmostLeaf(), idx: -1, modCount: t.modCount}
+}
+
+// Next advances to the next pair and reports whether there is one.
+func (c *Cursor[K, V]) Next() bool {
+	c.valid = false
+	if c.err != nil {
+		return false
+	}
+	if c.tree.modCount != c.modCount {
+		c.err = ErrConcurrentModification
+		return false
+	}
+	if c.reseek {
+		// The deleted key is gone, so the first key not less than it comes after it
+		c.reseek = false
+		c.leaf, c.idx = nil, 0
+		if c.tree.root != nil {
+			c.leaf, c.idx = c.tree.seek(c.key)
+		}
+	} else if c.leaf != nil {
+		c.idx++
+	}
+	for c.leaf != nil && c.idx >= len(c.leaf.keys) {
+		c.leaf = c.tree.nextLeaf(c.leaf)
+		c.idx = 0
+	}
+	if c.leaf == nil {
+		return false
+	}
+	c.key, c.value, c.valid = c.leaf.keys[c.idx], c.leaf.values[c.idx], true
+	return true
+}
+
+// Key returns the key at the current position. It stays readable after
+// Delete until the next call to Next.
+func (c *Cursor[K, V]) Key() K {
+	return c.key
+}
+
+// Value returns the value at the current position. It stays readable after
+// Delete until the next call to Next.
+func (c *Cursor[K, V]) Value() V {
+	return c.value
+}
+
+// Delete removes the pair at the current position from the tree and reports
+// whether there was one to remove; it does nothing before the first Next,
+// after the last, or twice on the same pair. The next Next moves to the pair
+// that followed it. On a frozen tree it stops the cursor, with Err returning
+// ErrFrozen.
+func (c *Cursor[K, V]) Delete() bool {
+	if !c.valid || c.err != nil {
+		return false
+	}
+	if err := c.tree.Delete(c.key); err != nil {
+		c.err = err
+		return false
+	}
+	c.modCount = c.tree.modCount
+	c.valid, c.reseek = false, true
+	return true
+}
+
+// Err returns ErrConcurrentModification if the cursor stopped because the
+// tree changed other than through Delete, ErrFrozen if Delete was refused, or
+// nil if it ran out of pairs.
+func (c *Cursor[K, V]) Err() error {
+	return c.err
+}
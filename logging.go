@@ -0,0 +1,77 @@
+package main
+
+// eventLogger receives the tree's debug events, see SetLogger. Callers check
+// it for nil before building the fields so an unset logger costs nothing.
+type eventLogger func(event string, fields map[string]any)
+
+// observer is handed down to the node methods that split, merge and borrow,
+// which report to it what they did. It counts splits and merges and passes
+// the events on to the logger if one is set. A nil observer ignores
+// everything, for work on scratch copies like ExplainDelete's.
+type observer struct {
+	logger eventLogger
+	splits uint64
+	merges uint64
+}
+
+func (o *observer) split(leaf bool, separator any, left, right int) {
+	if o == nil {
+		return
+	}
+	o.splits++
+	if o.logger != nil {
+		o.logger("split", map[string]any{"leaf": leaf, "separator": separator, "left": left, "right": right})
+	}
+}
+
+func (o *observer) merge(leaf bool, keys int) {
+	if o == nil {
+		return
+	}
+	o.merges++
+	if o.logger != nil {
+		o.logger("merge", map[string]any{"leaf": leaf, "keys": keys})
+	}
+}
+
+func (o *observer) borrow(leaf bool, from string) {
+	if o != nil && o.logger != nil {
+		o.logger("borrow", map[string]any{"leaf": leaf, "from": from})
+	}
+}
+
+// SetLogger installs fn to receive debug events as the tree changes, for
+// wiring into a structured logger; nil turns logging off. The events are:
+//
+//   - "insert" with "key" and "created" (false when an existing value was replaced)
+//   - "delete" with "key"
+//   - "split" with "leaf", "separator", and the key counts "left" and "right"
+//   - "merge" with "leaf" and "keys", the merged node's key count
+//   - "borrow" with "leaf" and "from" ("left" or "right")
+//
+// fn is called synchronously while the tree is mid-operation, so it must not
+// use the tree. Splits and merges are reported before the insert or delete
+// that caused them.
+func (t *BPlusTree[K, V]) SetLogger(fn func(event string, fields map[string]any)) {
+	t.obs.logger = fn
+}
+
+// SplitCount returns how many nodes have split, leaves and internal nodes
+// alike, since the tree was created or ResetCounters last called. Growing a
+// level counts as the split of the old root. Bulk loads and rebuilds pack
+// nodes directly and count nothing.
+func (t *BPlusTree[K, V]) SplitCount() uint64 {
+	return t.obs.splits
+}
+
+// MergeCount returns how many pairs of nodes have merged into one, by
+// Delete's rebalancing or DeleteCompact, since the tree was created or
+// ResetCounters last called.
+func (t *BPlusTree[K, V]) MergeCount() uint64 {
+	return t.obs.merges
+}
+
+// ResetCounters sets SplitCount and MergeCount back to zero.
+func (t *BPlusTree[K, V]) ResetCounters() {
+	t.obs.splits, t.obs.merges = 0, 0
+}
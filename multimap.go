@@ -0,0 +1,202 @@
+package main
+
+import (
+	"iter"
+	"sort"
+)
+
+// MultiMap is a B+ Tree in which a key can hold any number of values. The
+// values under a key stay in insertion order, or sorted by valueLess if one
+// is given, with equal values still in insertion order, so Get and All are
+// deterministic.
+type MultiMap[K comparable, V any] struct {
+	tree      *BPlusTree[K, valueList[V]]
+	valueLess func(V, V) bool
+	size      int // Values across all keys
+	maxPerKey int // Values kept in the leaf per key before overflowing, 0 for no cap
+}
+
+// valueList holds the values under one key: up to maxPerKey in the leaf
+// entry itself and the rest in a chain of overflow pages of that size.
+type valueList[V any] struct {
+	values   []V
+	overflow *overflowPage[V]
+	tail     *overflowPage[V] // Last overflow page, where unsorted Puts append
+	n        int
+}
+
+type overflowPage[V any] struct {
+	values []V
+	next   *overflowPage[V]
+}
+
+// NewMultiMap creates an empty multimap. valueLess may be nil to keep values
+// in insertion order.
+func NewMultiMap[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool, valueLess func(V, V) bool) *MultiMap[K, V] {
+	return &MultiMap[K, V]{
+		tree:      NewBPlusTree[K, valueList[V]](order, less, equal),
+		valueLess: valueLess,
+	}
+}
+
+// SetMaxValuesPerKey caps the values a key keeps in its leaf entry at n,
+// chaining the rest into overflow pages of n values each, so a hot key
+// doesn't make its leaf entry ever larger to copy. Without valueLess a Put
+// to such a key only touches its last page. n <= 0 removes the cap. Existing
+// keys are re-chunked to match.
+func (m *MultiMap[K, V]) SetMaxValuesPerKey(n int) {
+	if n < 0 {
+		n = 0
+	}
+	m.maxPerKey = n
+	for _, key := range m.tree.List() {
+		vl, _ := m.tree.Search(key)
+		m.tree.Insert(key, m.chunk(vl.all()))
+	}
+}
+
+// Put adds value under key, after any values under key it doesn't sort
+// before.
+func (m *MultiMap[K, V]) Put(key K, value V) {
+	vl, _ := m.tree.Search(key)
+	m.size++
+	if m.valueLess == nil && m.maxPerKey > 0 && vl.n >= m.maxPerKey {
+		if vl.tail == nil || len(vl.tail.values) == m.maxPerKey {
+			page := &overflowPage[V]{values: make([]V, 0, m.maxPerKey)}
+			if vl.tail == nil {
+				vl.overflow = page
+			} else {
+				vl.tail.next = page
+			}
+			vl.tail = page
+		}
+		vl.tail.values = append(vl.tail.values, value)
+		vl.n++
+		m.tree.Insert(key, vl)
+		return
+	}
+
+	values := vl.all()
+	pos := len(values)
+	if m.valueLess != nil {
+		pos = sort.Search(len(values), func(i int) bool { return m.valueLess(value, values[i]) })
+	}
+	values = append(values, value)
+	copy(values[pos+1:], values[pos:])
+	values[pos] = value
+	m.tree.Insert(key, m.chunk(values))
+}
+
+// Get returns the values under key in their kept order, or nil.
+func (m *MultiMap[K, V]) Get(key K) []V {
+	vl, _ := m.tree.Search(key)
+	return vl.all()
+}
+
+// DeleteValue removes the first value under key for which match holds and
+// reports whether there was one. The key goes once its last value does.
+func (m *MultiMap[K, V]) DeleteValue(key K, match func(V) bool) bool {
+	vl, _ := m.tree.Search(key)
+	values := vl.all()
+	for i, v := range values {
+		if !match(v) {
+			continue
+		}
+		if len(values) == 1 {
+			m.tree.Delete(key)
+		} else {
+			m.tree.Insert(key, m.chunk(append(values[:i], values[i+1:]...)))
+		}
+		m.size--
+		return true
+	}
+	return false
+}
+
+// DeleteKey removes key with all of its values and returns how many there were.
+func (m *MultiMap[K, V]) DeleteKey(key K) int {
+	vl, found := m.tree.Search(key)
+	if !found {
+		return 0
+	}
+	m.tree.Delete(key)
+	m.size -= vl.n
+	return vl.n
+}
+
+// Len returns the number of values across all keys.
+func (m *MultiMap[K, V]) Len() int {
+	return m.size
+}
+
+// Keys returns the distinct keys in order.
+func (m *MultiMap[K, V]) Keys() []K {
+	return m.tree.List()
+}
+
+// All returns every key-value pair, in key order and then in each key's
+// value order.
+func (m *MultiMap[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		m.tree.ascend(func(k K, vl valueList[V]) bool {
+			for v := range vl.each() {
+				if !yield(k, v) {
+					return false
+				}
+			}
+			return true
+		})
+	}
+}
+
+// chunk packs values, which it takes ownership of, into a valueList under the
+// current cap.
+func (m *MultiMap[K, V]) chunk(values []V) valueList[V] {
+	vl := valueList[V]{values: values, n: len(values)}
+	if m.maxPerKey == 0 || len(values) <= m.maxPerKey {
+		return vl
+	}
+	// Full slice expressions keep an append to one page out of the next
+	step := m.maxPerKey
+	vl.values = values[:step:step]
+	for start := step; start < len(values); start += step {
+		end := min(start+step, len(values))
+		page := &overflowPage[V]{values: values[start:end:end]}
+		if vl.tail == nil {
+			vl.overflow = page
+		} else {
+			vl.tail.next = page
+		}
+		vl.tail = page
+	}
+	return vl
+}
+
+// all returns a fresh slice of every value in order.
+func (vl valueList[V]) all() []V {
+	if vl.n == 0 {
+		return nil
+	}
+	values := make([]V, 0, vl.n)
+	for v := range vl.each() {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (vl valueList[V]) each() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range vl.values {
+			if !yield(v) {
+				return
+			}
+		}
+		for page := vl.overflow; page != nil; page = page.next {
+			for _, v := range page.values {
+				if !yield(v) {
+					return
+				}
+			}
+		}
+	}
+}
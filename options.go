@@ -0,0 +1,127 @@
+package main
+
+import "errors"
+
+// Option configures a tree in NewBPlusTree.
+type Option[K comparable, V any] func(*BPlusTree[K, V])
+
+// WithAllocator makes the tree take its nodes from a instead of the heap.
+func WithAllocator[K comparable, V any](a Allocator[K, V]) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.alloc = a
+	}
+}
+
+// WithKeyNormalizer stores and looks up every key as normalize(key), e.g.
+// strings.ToLower for case-insensitive string keys. Keys that normalize alike
+// are the same key. normalize must be idempotent and consistent with less.
+func WithKeyNormalizer[K comparable, V any](normalize func(K) K) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.normalize = normalize
+	}
+}
+
+// WithTimestamps records when each entry was created and last updated,
+// readable with GetMeta.
+func WithTimestamps[K comparable, V any]() Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.meta = make(map[K]EntryMeta)
+	}
+}
+
+// WithKeyValidator makes the tree refuse any key for which validate returns
+// an error, returning it wrapped together with ErrInvalidKey. Every write
+// that can add a key checks it: Insert, InsertUnique, InsertTracked, Update,
+// BatchInsert, BulkUpsert, AppendSorted, ReplaceAll, LoadSortedFile, Txn
+// and GetOrInsert, while GetOrLoad returns a refused loaded value without
+// storing it. Only
+// WithInsert, which builds a new version rather than writing to the tree,
+// doesn't consult it.
+func WithKeyValidator[K comparable, V any](validate func(K) error) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.keyValidator = validate
+	}
+}
+
+var errZeroKey = errors.New("zero value")
+
+// WithZeroKeyRejected is WithKeyValidator refusing the zero value of K, such
+// as "" for string keys.
+func WithZeroKeyRejected[K comparable, V any]() Option[K, V] {
+	return WithKeyValidator[K, V](func(key K) error {
+		if key == *new(K) {
+			return errZeroKey
+		}
+		return nil
+	})
+}
+
+// WithAccessTracking counts the Get hits of every key, readable with
+// AccessCount and LeastAccessed. Without it reads pay nothing extra.
+func WithAccessTracking[K comparable, V any]() Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.access = make(map[K]int)
+	}
+}
+
+// WithInsertionOrder numbers each key as it is inserted, so that
+// InInsertionOrder can list the entries in the order they arrived alongside
+// the usual key-ordered views.
+func WithInsertionOrder[K comparable, V any]() Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.arrival = make(map[K]uint64)
+	}
+}
+
+// WithCopyOnInsert makes the tree store copyKey(key) and copyValue(value)
+// instead of what the caller passed in, so that it owns its data. Without
+// it the tree keeps whatever it is given: a value that is a slice or map, or
+// a key holding a pointer, still aliases the caller's memory, and changing
+// that memory after the insert changes the stored entry too; for keys that
+// can silently break the ordering. Either function may be nil to leave that
+// side as it is. For []byte values, for example:
+//
+//	WithCopyOnInsert[string, []byte](nil, bytes.Clone)
+//
+// Copies are taken on every path that stores an entry, including updates,
+// WithInsert, ReplaceAll and LoadSortedFile; when a key is already present
+// only the value is copied, as the stored key is kept.
+func WithCopyOnInsert[K comparable, V any](copyKey func(K) K, copyValue func(V) V) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.copyKey = copyKey
+		t.copyValue = copyValue
+	}
+}
+
+// WithContentEncoding sets how ContentHash and RangeHash encode keys and
+// values, for types whose default encoding isn't faithful: pointers, or
+// structs holding them, whose %v formatting shows addresses, and any type
+// whose distinct values format alike. encodeValue might hash what a pointer
+// points to, for example. Either function may be nil to keep the default for
+// that side. Trees compared by hash must use the same encodings.
+func WithContentEncoding[K comparable, V any](encodeKey func(K) []byte, encodeValue func(V) []byte) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		t.hashKey = encodeKey
+		t.hashValue = encodeValue
+	}
+}
+
+// WithSortKey orders keys by comparing sortKey(key) bytewise, in place of
+// the less and equal passed to NewBPlusTree (which may then be nil), for
+// keys whose natural comparison is costly, such as composite string keys
+// that would otherwise be parsed on every call. Each key's sort key is
+// computed once and cached, for up to 65536 keys before the cache starts
+// over, so a comparison costs two map lookups and a bytes.Compare. That is
+// slower than a cheap less, so this only pays when less is expensive. The
+// cache is locked, serializing concurrent readers briefly on each
+// comparison, and it keeps the keys it holds alive.
+//
+// Keys with equal sort keys are the same key. Reindex replaces the ordering
+// with the one it is given.
+func WithSortKey[K comparable, V any](sortKey func(K) []byte) Option[K, V] {
+	return func(t *BPlusTree[K, V]) {
+		c := &sortKeyCache[K]{sortKey: sortKey, keys: make(map[K][]byte)}
+		t.less, t.equal = c.less, c.equal
+		t.sortKeys = c
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+)
+
+// PageID identifies a stored node. IDs start at 1.
+type PageID uint64
+
+// Page is the stored form of one node, with children referenced by ID rather
+// than by pointer so it can live outside memory.
+type Page[K comparable, V any] struct {
+	IsLeaf   bool
+	Keys     []K
+	Values   []V      // Leaves only
+	Children []PageID // Internal nodes only
+}
+
+// PageStore holds a tree's nodes one page per node. A tree opened on a store
+// with OpenPages reads its nodes through ReadNode as it first reaches them
+// and writes them back through WriteNode on SyncPages; WritePages and
+// ReadPages instead move a whole tree in or out at once.
+type PageStore[K comparable, V any] interface {
+	ReadNode(id PageID) (Page[K, V], error)
+	WriteNode(id PageID, page Page[K, V]) error
+	// AllocPage returns an ID no page in the store uses yet.
+	AllocPage() (PageID, error)
+}
+
+// MemPageStore is the in-memory PageStore.
+type MemPageStore[K comparable, V any] struct {
+	pages map[PageID]Page[K, V]
+	last  PageID // Highest ID written or handed out
+}
+
+func NewMemPageStore[K comparable, V any]() *MemPageStore[K, V] {
+	return &MemPageStore[K, V]{pages: make(map[PageID]Page[K, V])}
+}
+
+func (s *MemPageStore[K, V]) ReadNode(id PageID) (Page[K, V], error) {
+	page, ok := s.pages[id]
+	if !ok {
+		return Page[K, V]{}, fmt.Errorf("read page %d: %w", id, ErrPageNotFound)
+	}
+	return page, nil
+}
+
+// WriteNode stores a copy of page, so the caller may reuse its slices.
+func (s *MemPageStore[K, V]) WriteNode(id PageID, page Page[K, V]) error {
+	s.pages[id] = Page[K, V]{
+		IsLeaf:   page.IsLeaf,
+		Keys:     append([]K(nil), page.Keys...),
+		Values:   append([]V(nil), page.Values...),
+		Children: append([]PageID(nil), page.Children...),
+	}
+	s.last = max(s.last, id)
+	return nil
+}
+
+func (s *MemPageStore[K, V]) AllocPage() (PageID, error) {
+	s.last++
+	return s.last, nil
+}
+
+// checkPage rejects a page whose counts can't make a node: a leaf needs a
+// value per key and no children, an internal node one more child than keys.
+func checkPage[K comparable, V any](id PageID, page Page[K, V]) error {
+	switch {
+	case page.IsLeaf && (len(page.Values) != len(page.Keys) || len(page.Children) != 0):
+		return fmt.Errorf("page %d: leaf with %d keys, %d values and %d children: %w", id, len(page.Keys), len(page.Values), len(page.Children), ErrCorruptPage)
+	case !page.IsLeaf && (len(page.Keys) == 0 || len(page.Children) != len(page.Keys)+1 || len(page.Values) != 0):
+		return fmt.Errorf("page %d: internal node with %d keys, %d children and %d values: %w", id, len(page.Keys), len(page.Children), len(page.Values), ErrCorruptPage)
+	}
+	return nil
+}
+
+// pageSource reads the nodes of a tree opened with OpenPages. Nodes not read
+// yet are stubs holding only their page ID and the source; child reads a
+// stub the first time a walk reaches it.
+type pageSource[K comparable, V any] struct {
+	store  PageStore[K, V]
+	alloc  Allocator[K, V]
+	parent map[PageID]PageID // Page each page was first listed under; the root's is 0
+}
+
+// load reads stub n's page into it, leaving a stub for each child. A page
+// listed twice, under two parents or twice in one, is corrupt; that covers
+// one listed under itself or its own descendants, so the tree can't come out
+// cyclic.
+func (s *pageSource[K, V]) load(n *BPlusTreeNode[K, V]) error {
+	page, err := s.store.ReadNode(n.page)
+	if err != nil {
+		return err
+	}
+	if err := checkPage(n.page, page); err != nil {
+		return err
+	}
+	for i, id := range page.Children {
+		if p, ok := s.parent[id]; ok && p != n.page {
+			return fmt.Errorf("page %d: child %d is already listed under page %d: %w", n.page, id, p, ErrCorruptPage)
+		}
+		if slices.Contains(page.Children[:i], id) {
+			return fmt.Errorf("page %d: child %d is listed twice: %w", n.page, id, ErrCorruptPage)
+		}
+		s.parent[id] = n.page
+	}
+	n.isLeaf = page.IsLeaf
+	n.keys = append(n.keys[:0], page.Keys...)
+	n.values = append(n.values[:0], page.Values...)
+	n.children = n.children[:0]
+	for _, id := range page.Children {
+		stub := newBPlusTreeNode(s.alloc, n.order)
+		stub.page, stub.src = id, s
+		n.children = append(n.children, stub)
+	}
+	n.src = nil
+	return nil
+}
+
+// child returns n's i-th child, first reading it from its page store if it
+// is a stub of a paged tree. Reads have no error result to report a failing
+// store through, so that panics.
+func (n *BPlusTreeNode[K, V]) child(i int) *BPlusTreeNode[K, V] {
+	c := n.children[i]
+	if c.src != nil {
+		if err := c.src.load(c); err != nil {
+			panic(err)
+		}
+	}
+	return c
+}
+
+// OpenPages opens the tree whose root is at page root of store without
+// reading it all: only the root page is read now, and every other node the
+// first time an operation reaches it, so a lookup reads one page per level.
+// Nodes stay in memory once read; there is no buffer pool evicting them
+// yet. Changes stay in memory too until SyncPages writes them back.
+//
+// A page that would make the tree malformed, by its key, value and child
+// counts or by being listed under two parents, fails here for the root and
+// panics with ErrCorruptPage when reached later, as does a failing store.
+func OpenPages[K comparable, V any](store PageStore[K, V], root PageID, order int, less func(K, K) bool, equal func(K, K) bool, opts ...Option[K, V]) (*BPlusTree[K, V], error) {
+	if err := checkOrder(order); err != nil {
+		return nil, err
+	}
+	t := NewBPlusTree[K, V](order, less, equal, opts...)
+	t.pages = &pageSource[K, V]{store: store, alloc: t.alloc, parent: map[PageID]PageID{root: 0}}
+	t.root.page, t.root.src = root, t.pages
+	if err := t.pages.load(t.root); err != nil {
+		return nil, fmt.Errorf("open pages: %w", err)
+	}
+	return t, nil
+}
+
+// SyncPages writes t's changes back to the store it was opened on and
+// returns the root's page ID, which changes when the root splits or
+// collapses; open the tree from it next time. Nodes never read are
+// unchanged and not written. Every node that has been read is written back,
+// whether or not it changed, since nodes don't track that; new nodes get new
+// pages. Pages of nodes dropped by merges are left in the store, unreferenced.
+// For a tree not opened with OpenPages it returns ErrNotPaged.
+func (t *BPlusTree[K, V]) SyncPages() (PageID, error) {
+	if t.pages == nil {
+		return 0, fmt.Errorf("sync pages: %w", ErrNotPaged)
+	}
+	store := t.pages.store
+	var write func(n *BPlusTreeNode[K, V]) (PageID, error)
+	write = func(n *BPlusTreeNode[K, V]) (PageID, error) {
+		if n.src != nil {
+			return n.page, nil
+		}
+		page := Page[K, V]{IsLeaf: n.isLeaf, Keys: n.keys}
+		if n.isLeaf {
+			page.Values = n.values
+		}
+		for _, child := range n.children {
+			id, err := write(child)
+			if err != nil {
+				return 0, err
+			}
+			page.Children = append(page.Children, id)
+		}
+		if n.page == 0 {
+			id, err := store.AllocPage()
+			if err != nil {
+				return 0, err
+			}
+			n.page = id
+		}
+		return n.page, store.WriteNode(n.page, page)
+	}
+	root, err := write(t.root)
+	if err != nil {
+		return 0, fmt.Errorf("sync pages: %w", err)
+	}
+	return root, nil
+}
+
+// WritePages writes every node of t to store as new pages, children before
+// their parent, and returns the root's ID for ReadPages or OpenPages. Later
+// changes to t don't reach the store; write the pages again to save them.
+func (t *BPlusTree[K, V]) WritePages(store PageStore[K, V]) (PageID, error) {
+	var write func(n *BPlusTreeNode[K, V]) (PageID, error)
+	write = func(n *BPlusTreeNode[K, V]) (PageID, error) {
+		page := Page[K, V]{IsLeaf: n.isLeaf, Keys: n.keys}
+		if n.isLeaf {
+			page.Values = n.values
+		}
+		for i := range n.children {
+			id, err := write(n.child(i))
+			if err != nil {
+				return 0, err
+			}
+			page.Children = append(page.Children, id)
+		}
+		id, err := store.AllocPage()
+		if err != nil {
+			return 0, err
+		}
+		return id, store.WriteNode(id, page)
+	}
+	if t.root == nil {
+		return write(newBPlusTreeNode(t.alloc, t.order))
+	}
+	return write(t.root)
+}
+
+// ReadPages rebuilds a tree written by WritePages from the root page down,
+// reading every page up front and relinking the leaf chain as the leaves are
+// read in key order. The tree keeps no link to the store. A page with counts
+// that can't make a node, or reached twice, fails with ErrCorruptPage, and
+// the finished tree must pass Validate, so a corrupt store can't produce a
+// tree that misbehaves later.
+func ReadPages[K comparable, V any](store PageStore[K, V], root PageID, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	if err := checkOrder(order); err != nil {
+		return nil, err
+	}
+	t := NewBPlusTree[K, V](order, less, equal)
+	seen := make(map[PageID]bool)
+	var prev *BPlusTreeNode[K, V]
+	var read func(id PageID) (*BPlusTreeNode[K, V], error)
+	read = func(id PageID) (*BPlusTreeNode[K, V], error) {
+		if seen[id] {
+			return nil, fmt.Errorf("page %d reached twice: %w", id, ErrCorruptPage)
+		}
+		seen[id] = true
+		page, err := store.ReadNode(id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkPage(id, page); err != nil {
+			return nil, err
+		}
+		n := newBPlusTreeNode(t.alloc, order)
+		n.isLeaf = page.IsLeaf
+		n.keys = append(n.keys, page.Keys...)
+		if n.isLeaf {
+			n.values = append(n.values, page.Values...)
+			if prev != nil {
+				prev.next = n
+			}
+			prev = n
+			return n, nil
+		}
+		for _, childID := range page.Children {
+			child, err := read(childID)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, child)
+		}
+		return n, nil
+	}
+	n, err := read(root)
+	if err != nil {
+		return nil, err
+	}
+	t.root = n
+	if err := t.Validate(); err != nil {
+		return nil, fmt.Errorf("read pages: %w: %w", ErrCorruptPage, err)
+	}
+	return t, nil
+}
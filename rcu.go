@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// RCUBPlusTree is a B+ Tree for read-dominated workloads: readers load the
+// current version with a single atomic read and never block, while writers
+// serialize among themselves, build a new version and swap it in. Published
+// versions are never modified, so a reader keeps a consistent view for as
+// long as it holds one.
+//
+// Inserts copy only the path to the affected leaf (see WithInsert). Deletes
+// currently copy the whole tree before rebalancing it, so they cost O(n);
+// prefer ConcurrentBPlusTree for delete-heavy use.
+//
+// Options that keep per-tree bookkeeping (LRU bounds, versioning, hooks) are
+// not supported, which is why the constructor takes none.
+type RCUBPlusTree[K comparable, V any] struct {
+	mu      sync.Mutex // Serializes writers only
+	current atomic.Pointer[BPlusTree[K, V]]
+}
+
+func NewRCUBPlusTree[K comparable, V any](order int, less func(K, K) bool, equal func(K, K) bool) *RCUBPlusTree[K, V] {
+	t := NewBPlusTree[K, V](order, less, equal)
+	t.cow = true // Published versions share nodes and must never be written in place
+	r := &RCUBPlusTree[K, V]{}
+	r.current.Store(t)
+	return r
+}
+
+// Snapshot returns the current version. It is a private copy of the tree
+// header, so the caller may even modify it without affecting readers or
+// later versions.
+func (r *RCUBPlusTree[K, V]) Snapshot() *BPlusTree[K, V] {
+	t := *r.current.Load()
+	return &t
+}
+
+func (r *RCUBPlusTree[K, V]) Get(key K) (V, bool) {
+	return r.current.Load().Search(key)
+}
+
+func (r *RCUBPlusTree[K, V]) Exists(key K) bool {
+	return r.current.Load().Exists(key)
+}
+
+func (r *RCUBPlusTree[K, V]) Count() int {
+	return r.current.Load().Count()
+}
+
+func (r *RCUBPlusTree[K, V]) Range(start K, end K) map[K]V {
+	return r.current.Load().Range(start, end)
+}
+
+func (r *RCUBPlusTree[K, V]) Insert(key K, value V) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	base := *r.current.Load() // WithInsert flags its receiver, so never pass the published header
+	r.current.Store(base.WithInsert(key, value))
+}
+
+func (r *RCUBPlusTree[K, V]) Delete(key K) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur := r.current.Load()
+	if !cur.Exists(key) {
+		return
+	}
+	next := *cur
+	next.Delete(key) // Takes a private copy of every node first, see own
+	next.cow = true
+	r.current.Store(&next)
+}
+
+func (r *RCUBPlusTree[K, V]) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cur := r.current.Load()
+	next := NewBPlusTree[K, V](cur.order, cur.less, cur.equal)
+	next.cow = true
+	r.current.Store(next)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+// sortKeyCacheSize bounds the keys sortKeyCache remembers. Lookups of keys
+// the tree never stores are cached too, so the cache is dropped and refilled
+// rather than left to grow.
+const sortKeyCacheSize = 1 << 16
+
+// sortKeyCache memoizes sortKey, which WithSortKey's comparators call on
+// both sides of every comparison. Reads of the tree go through it too, hence
+// the lock: concurrent readers under ConcurrentBPlusTree or RCUBPlusTree
+// share it.
+type sortKeyCache[K comparable] struct {
+	mu      sync.Mutex
+	sortKey func(K) []byte
+	keys    map[K][]byte
+}
+
+func (c *sortKeyCache[K]) get(key K) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.keys[key]; ok {
+		return b
+	}
+	if len(c.keys) >= sortKeyCacheSize {
+		clear(c.keys)
+	}
+	b := c.sortKey(key)
+	c.keys[key] = b
+	return b
+}
+
+func (c *sortKeyCache[K]) less(a, b K) bool {
+	return bytes.Compare(c.get(a), c.get(b)) < 0
+}
+
+func (c *sortKeyCache[K]) equal(a, b K) bool {
+	return a == b || bytes.Equal(c.get(a), c.get(b))
+}
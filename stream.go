@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Save writes magic "BPT" and this version before the tree's order and
+// pairs. Bump it whenever the layout after the header changes, and keep Load
+// able to read the older versions.
+const (
+	saveMagic   = "BPT"
+	saveVersion = 1
+)
+
+// EncodeStream writes every pair to w in key order as a stream of gob values,
+// one per entry, so the encoded form is never held in memory as a whole.
+func (t *BPlusTree[K, V]) EncodeStream(w io.Writer) error {
+	return t.encodePairs(gob.NewEncoder(w))
+}
+
+// encodePairs writes each pair as its own gob message. Gob prefixes each
+// message with its length as a gob varint, which can't overflow, so
+// multi-megabyte values need no special handling. The one limit is gob's cap
+// of 8 GiB per message on 64-bit platforms (1 GiB on 32-bit), which fails
+// cleanly and is reported with the key whose value hit it.
+//
+// Values are always stored inline, in their leaf and in its Page alike;
+// keeping oversized ones out of line behind a threshold option was declined.
+// Store big values behind a pointer or slice type to keep leaves small.
+func (t *BPlusTree[K, V]) encodePairs(enc *gob.Encoder) error {
+	var err error
+	t.ascend(func(k K, v V) bool {
+		if err = enc.Encode(Pair[K, V]{Key: k, Value: v}); err != nil {
+			err = fmt.Errorf("encode '%v': %w", k, err)
+		}
+		return err == nil
+	})
+	return err
+}
+
+// BuildFromStream reads pairs written by EncodeStream and bulk loads them into
+// a new tree as they are decoded. Pairs out of key order, which EncodeStream
+// never writes, fail with ErrUnsortedInput rather than building a tree whose
+// lookups miss.
+func BuildFromStream[K comparable, V any](r io.Reader, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	if err := checkOrder(order); err != nil {
+		return nil, err
+	}
+	return decodePairs[K, V](gob.NewDecoder(r), order, less, equal)
+}
+
+func decodePairs[K comparable, V any](dec *gob.Decoder, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	b := newBulkBuilder[K, V](order, less, equal)
+	for n := 0; ; n++ {
+		var p Pair[K, V]
+		if err := dec.Decode(&p); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+		if err := b.addSorted(p.Key, p.Value); err != nil {
+			return nil, fmt.Errorf("decode pair %d: %w", n, err)
+		}
+	}
+	return b.finish(), nil
+}
+
+// Save writes the tree to w behind a versioned header, so Load can tell the
+// format apart from anything else and from future revisions of it. The order
+// is saved too; the comparators have to be supplied again on Load.
+func (t *BPlusTree[K, V]) Save(w io.Writer) error {
+	if _, err := w.Write(append([]byte(saveMagic), saveVersion)); err != nil {
+		return err
+	}
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(t.order); err != nil {
+		return err
+	}
+	return t.encodePairs(enc)
+}
+
+// Load reads a tree written by Save. Input without the header fails with
+// ErrInvalidFormat and a version this build doesn't know with
+// ErrUnknownVersion, rather than being decoded as garbage.
+func Load[K comparable, V any](r io.Reader, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	return load[K, V](r, 0, less, equal)
+}
+
+// LoadWithOrder reads a tree written by Save like Load, but builds it at
+// order instead of the order it was saved with. Only the pairs are saved and
+// the nodes are packed afresh either way, so any legal order works without
+// migrating the data; an illegal one fails before anything is read.
+func LoadWithOrder[K comparable, V any](r io.Reader, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	if err := checkOrder(order); err != nil {
+		return nil, fmt.Errorf("load: %w", err)
+	}
+	return load[K, V](r, order, less, equal)
+}
+
+// load reads a saved tree, building it at order or, if that is 0, at the
+// saved order.
+func load[K comparable, V any](r io.Reader, order int, less func(K, K) bool, equal func(K, K) bool) (*BPlusTree[K, V], error) {
+	header := make([]byte, len(saveMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("load: reading header: %w", err)
+	}
+	if string(header[:len(saveMagic)]) != saveMagic {
+		return nil, fmt.Errorf("load: %w", ErrInvalidFormat)
+	}
+	switch version := header[len(saveMagic)]; version {
+	case 1:
+		dec := gob.NewDecoder(r)
+		var saved int
+		if err := dec.Decode(&saved); err != nil {
+			return nil, fmt.Errorf("load: reading order: %w", err)
+		}
+		if order == 0 {
+			if err := checkOrder(saved); err != nil {
+				return nil, fmt.Errorf("load: %w", err)
+			}
+			order = saved
+		}
+		return decodePairs[K, V](dec, order, less, equal)
+	default:
+		return nil, fmt.Errorf("load: format version %d (this build reads up to %d): %w", version, saveVersion, ErrUnknownVersion)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import "strings"
+
+// Helpers for trees keyed by strings and ordered with StringLess, where all
+// keys sharing a prefix sit next to each other in the leaf chain.
+
+// DeletePrefix removes every key starting with prefix and returns how many
+// were removed, e.g. a whole "session:user42:" namespace. The scan starts at
+// prefix itself and stops at the first key that doesn't match.
+func DeletePrefix[V any](t *BPlusTree[string, V], prefix string) int {
+	prefix = t.norm(prefix)
+	t.mustWritable("delete")
+	var doomed []string
+	t.ascendFrom(prefix, func(k string, _ V) bool {
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		doomed = append(doomed, k)
+		return true
+	})
+	for _, key := range doomed {
+		t.Delete(key)
+	}
+	return len(doomed)
+}
+
+// MatchGlob returns, in key order, the pairs whose keys match pattern, where
+// * matches any run of characters and ? any single one. The literal prefix
+// before the first wildcard bounds the scan like DeletePrefix; a pattern that
+// starts with a wildcard scans every key. The pattern is normalized like a
+// key, so with a strings.ToLower normalizer "FOO*" finds "foo1".
+func MatchGlob[V any](t *BPlusTree[string, V], pattern string) []Pair[string, V] {
+	pattern = t.norm(pattern)
+	prefix := pattern
+	if i := strings.IndexAny(pattern, "*?"); i >= 0 {
+		prefix = pattern[:i]
+	}
+	var pairs []Pair[string, V]
+	t.ascendFrom(prefix, func(k string, v V) bool {
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		if globMatch(pattern, k) {
+			pairs = append(pairs, Pair[string, V]{Key: k, Value: v})
+		}
+		return true
+	})
+	return pairs
+}
+
+// globMatch reports whether s matches pattern, backtracking only to the most
+// recent * so it runs in O(len(pattern) * len(s)) at worst.
+func globMatch(pattern, s string) bool {
+	p, k := []rune(pattern), []rune(s)
+	pi, ki := 0, 0
+	star, mark := -1, 0 // Last * seen and where in k it started matching
+	for ki < len(k) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			star, mark = pi, ki
+			pi++
+		case pi < len(p) && (p[pi] == '?' || p[pi] == k[ki]):
+			pi++
+			ki++
+		case star >= 0:
+			mark++
+			pi, ki = star+1, mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,34 @@
+package main
+
+import "time"
+
+// Helpers for time-series trees keyed by time.Time.
+
+// NewTimeTree creates a tree keyed by instants, ordered with TimeLess and
+// TimeEqual so keys in different locations still compare by the moment they
+// name.
+func NewTimeTree[V any](order int, opts ...Option[time.Time, V]) *BPlusTree[time.Time, V] {
+	return NewBPlusTree[time.Time, V](order, TimeLess, TimeEqual, opts...)
+}
+
+// RangeTime returns, in time order, the pairs with keys from from to to,
+// both inclusive.
+func RangeTime[V any](t *BPlusTree[time.Time, V], from time.Time, to time.Time) []Pair[time.Time, V] {
+	var pairs []Pair[time.Time, V]
+	t.ascendRange(from, to, func(k time.Time, v V) bool {
+		pairs = append(pairs, Pair[time.Time, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
+
+// LastSince returns, in time order, the pairs with keys no earlier than d
+// before now, including any stamped in the future.
+func LastSince[V any](t *BPlusTree[time.Time, V], d time.Duration) []Pair[time.Time, V] {
+	var pairs []Pair[time.Time, V]
+	t.ascendFrom(time.Now().Add(-d), func(k time.Time, v V) bool {
+		pairs = append(pairs, Pair[time.Time, V]{Key: k, Value: v})
+		return true
+	})
+	return pairs
+}
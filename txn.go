@@ -0,0 +1,66 @@
+package main
+
+// Txn buffers the writes of one Txn call so they are applied together.
+type Txn[K comparable, V any] struct {
+	tree *BPlusTree[K, V]
+	ops  []txnOp[K, V]
+	seen map[K]txnOp[K, V] // Latest buffered op per key, for Get
+}
+
+type txnOp[K comparable, V any] struct {
+	key     K
+	value   V
+	deleted bool
+}
+
+// Txn runs fn and then applies every write it made through tx in order, or,
+// if fn returns an error, none of them; that error is returned. Keys are
+// checked against the key validator as they are buffered, so a commit can't
+// fail halfway.
+func (t *BPlusTree[K, V]) Txn(fn func(tx *Txn[K, V]) error) error {
+	if err := t.writable("txn"); err != nil {
+		return err
+	}
+	tx := &Txn[K, V]{tree: t, seen: make(map[K]txnOp[K, V])}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	for _, op := range tx.ops {
+		if op.deleted {
+			t.Delete(op.key)
+		} else {
+			t.Insert(op.key, op.value)
+		}
+	}
+	return nil
+}
+
+// Insert buffers an insert of key, failing now if the key validator refuses it.
+func (tx *Txn[K, V]) Insert(key K, value V) error {
+	key = tx.tree.norm(key)
+	if err := tx.tree.admit("insert", key); err != nil {
+		return err
+	}
+	tx.buffer(txnOp[K, V]{key: key, value: value})
+	return nil
+}
+
+// Delete buffers a delete of key.
+func (tx *Txn[K, V]) Delete(key K) {
+	tx.buffer(txnOp[K, V]{key: tx.tree.norm(key), deleted: true})
+}
+
+// Get reads key as the transaction sees it: its own buffered writes first,
+// then the tree.
+func (tx *Txn[K, V]) Get(key K) (V, bool) {
+	key = tx.tree.norm(key)
+	if op, ok := tx.seen[key]; ok {
+		return op.value, !op.deleted
+	}
+	return tx.tree.Search(key)
+}
+
+func (tx *Txn[K, V]) buffer(op txnOp[K, V]) {
+	tx.ops = append(tx.ops, op)
+	tx.seen[op.key] = op
+}